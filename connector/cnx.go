@@ -9,3 +9,11 @@ type Cnx interface {
 	//Returns a connector
 	OpenCnx([]string) (*sql.DB, error)
 }
+
+//Dialecter is implemented by the cnx drivers that can
+//tell which SQL dialect they speak
+type Dialecter interface {
+
+	//Returns the dialect name (e.g. mysql)
+	Dialect() string
+}
@@ -0,0 +1,43 @@
+package connector
+
+import "context"
+
+//Level is the severity of a log entry
+type Level int
+
+//Levels of the log entries, from the most verbose
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+//Logger receives what the connectors and queries have to say.
+//keyvals alternate keys and values, as log/slog does
+type Logger interface {
+	Log(ctx context.Context, level Level, msg string, keyvals ...interface{})
+}
+
+//Logged is implemented by the cnx drivers configured with a logger
+type Logged interface {
+
+	//Returns the logger of the cnx
+	Logger() Logger
+}
+
+//NopLogger discards everything, it is the default logger
+type NopLogger struct {
+}
+
+//Log does nothing
+func (NopLogger) Log(ctx context.Context, level Level, msg string, keyvals ...interface{}) {
+}
+
+//loggerOf returns logger, or a NopLogger when nil
+func loggerOf(logger Logger) Logger {
+	if logger == nil {
+		return NopLogger{}
+	}
+	return logger
+}
@@ -0,0 +1,78 @@
+package connector
+
+import "context"
+
+//Statement is a SQL statement on its way to database/sql.
+//Middlewares may rewrite its SQL and Args before passing it on
+type Statement struct {
+
+	//INSERT, UPDATE, DELETE, SELECT or EXPLAIN
+	Operation string
+
+	//The table the statement primarily works on
+	Table string
+
+	SQL  string
+	Args []interface{}
+}
+
+//Exec runs a statement
+type Exec func(ctx context.Context, statement *Statement) error
+
+//Middleware wraps the execution of statements. It can inspect or
+//modify the statement before calling next, or reject it by returning
+//an error without calling next
+type Middleware func(next Exec) Exec
+
+//Chainer is implemented by the cnx drivers carrying middlewares
+type Chainer interface {
+
+	//Returns the middlewares, outermost first
+	Middlewares() []Middleware
+}
+
+//Chain wraps exec in middlewares, the first one being the outermost
+func Chain(middlewares []Middleware, exec Exec) Exec {
+	for index := len(middlewares) - 1; index >= 0; index-- {
+		exec = middlewares[index](exec)
+	}
+	return exec
+}
+
+//Use returns cnx with middlewares added to the ones it already carries.
+//Every query opened with it runs its statements through them
+//cnx := connector.Use(connector.MySQLCnx{}, tenant, tracing)
+func Use(cnx Cnx, middlewares ...Middleware) Cnx {
+	if chained, ok := cnx.(*chainedCnx); ok {
+		all := append([]Middleware{}, chained.middlewares...)
+		return &chainedCnx{chained.Cnx, append(all, middlewares...)}
+	}
+	return &chainedCnx{cnx, middlewares}
+}
+
+//chainedCnx is a Cnx carrying middlewares, it opens the wrapped one
+type chainedCnx struct {
+	Cnx
+	middlewares []Middleware
+}
+
+//Dialect returns the dialect of the wrapped cnx, if it tells
+func (cnx *chainedCnx) Dialect() string {
+	if dialecter, ok := cnx.Cnx.(Dialecter); ok {
+		return dialecter.Dialect()
+	}
+	return ""
+}
+
+//Logger returns the logger of the wrapped cnx, if it has one
+func (cnx *chainedCnx) Logger() Logger {
+	if logged, ok := cnx.Cnx.(Logged); ok {
+		return logged.Logger()
+	}
+	return NopLogger{}
+}
+
+//Middlewares returns the middlewares, outermost first
+func (cnx *chainedCnx) Middlewares() []Middleware {
+	return cnx.middlewares
+}
@@ -1,14 +1,18 @@
 package connector
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
+
 	//Import all package for use of mysql
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 )
 
 //MySQLCnx is CnxOpener for MySql
 type MySQLCnx struct {
+
+	//Where connection attempts and failovers are logged, nowhere if nil
+	Log Logger
 }
 
 //OpenCnx opens a connection to a MySQL server.
@@ -18,24 +22,55 @@ func (CnxOpener MySQLCnx) OpenCnx(dbCons []string) (*sql.DB, error) {
 
 	var db *sql.DB
 	var err error
+	logger := CnxOpener.Logger()
+	ctx := context.Background()
 
 	for index := 0; index < len(dbCons); index++ {
+		dsn := redactDSN(dbCons[index])
+		logger.Log(ctx, LevelDebug, "qw: opening connection", "dsn", dsn)
+
 		//Check dns format
 		db, err = sql.Open("mysql", dbCons[index])
 		if err != nil {
-			fmt.Println(dbCons[index] + " failed to open")
+			logger.Log(ctx, LevelWarn, "qw: connection failed to open", "dsn", dsn, "error", err)
 		} else {
 			//Check database connectivity
 			err = db.Ping()
 			if err != nil {
-				fmt.Println(dbCons[index] + " failed to answer ping")
+				logger.Log(ctx, LevelWarn, "qw: connection failed to answer ping", "dsn", dsn, "error", err)
 			} else {
 				//Database is answering, break here
+				logger.Log(ctx, LevelInfo, "qw: connection opened", "dsn", dsn, "failovers", index)
 				break
 			}
 			defer db.Close()
 
 		}
 	}
+	if err != nil {
+		logger.Log(ctx, LevelError, "qw: no connection could be opened", "error", err)
+	}
 	return db, err
 }
+
+//Dialect returns the SQL dialect spoken by MySQL
+func (CnxOpener MySQLCnx) Dialect() string {
+	return "mysql"
+}
+
+//Logger returns the logger of the connector
+func (CnxOpener MySQLCnx) Logger() Logger {
+	return loggerOf(CnxOpener.Log)
+}
+
+//redactDSN hides the password of dsn so it can be logged
+func redactDSN(dsn string) string {
+	config, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return "invalid dsn"
+	}
+	if config.Passwd != "" {
+		config.Passwd = "xxxxx"
+	}
+	return config.FormatDSN()
+}
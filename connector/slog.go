@@ -0,0 +1,36 @@
+//go:build go1.21
+// +build go1.21
+
+package connector
+
+import (
+	"context"
+	"log/slog"
+)
+
+//slogLevels maps the levels on the log/slog ones
+var slogLevels = map[Level]slog.Level{
+	LevelDebug: slog.LevelDebug,
+	LevelInfo:  slog.LevelInfo,
+	LevelWarn:  slog.LevelWarn,
+	LevelError: slog.LevelError,
+}
+
+//SlogLogger adapts a log/slog logger, slog.Default() if nil
+//cnx := connector.MySQLCnx{Log: connector.SlogLogger(slog.Default())}
+func SlogLogger(logger *slog.Logger) Logger {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return slogLogger{logger}
+}
+
+//slogLogger is a Logger writing to log/slog
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+//Log writes msg and keyvals at the matching slog level
+func (l slogLogger) Log(ctx context.Context, level Level, msg string, keyvals ...interface{}) {
+	l.logger.Log(ctx, slogLevels[level], msg, keyvals...)
+}
@@ -0,0 +1,140 @@
+package query
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+//Converter converts values of a Go type to and from their database
+//representation. It takes precedence over driver.Valuer and
+//sql.Scanner, which are honoured otherwise
+type Converter struct {
+
+	//Returns the value written for the Go value
+	ToDB func(value interface{}) (driver.Value, error)
+
+	//Returns the Go value of src, the value read from the database
+	//(nil, int64, float64, bool, []byte, string or time.Time)
+	FromDB func(src interface{}) (interface{}, error)
+}
+
+//converters is the registry of the Converters by Go type and by name
+var converters = struct {
+	sync.RWMutex
+	byType map[reflect.Type]*Converter
+	byName map[string]*Converter
+}{
+	byType: make(map[reflect.Type]*Converter),
+	byName: make(map[string]*Converter),
+}
+
+//RegisterType registers converter for every field, Insert and Update
+//value and WhereValue argument of the type of proto
+//	query.RegisterType(Cents(0), centsConverter)
+func RegisterType(proto interface{}, converter Converter) {
+	converters.Lock()
+	converters.byType[reflect.TypeOf(proto)] = &converter
+	converters.Unlock()
+
+	//Fields were resolved without this converter
+	resetMetaCache()
+}
+
+//RegisterConverter registers converter under name, used by the
+//fields tagged with the conv option
+//	IP net.IP `db:"ip,conv=inet"`
+func RegisterConverter(name string, converter Converter) {
+	converters.Lock()
+	converters.byName[name] = &converter
+	converters.Unlock()
+
+	resetMetaCache()
+}
+
+//converterOf returns the converter named name, or the one of type t
+//when name is empty
+func converterOf(t reflect.Type, name string) *Converter {
+	converters.RLock()
+	defer converters.RUnlock()
+
+	if name != "" {
+		return converters.byName[name]
+	}
+	return converters.byType[t]
+}
+
+//toDB converts value with converter, or with the converter of its type
+//when converter is nil
+func toDB(value interface{}, converter *Converter) (interface{}, error) {
+	if converter == nil && value != nil {
+		converter = converterOf(reflect.TypeOf(value), "")
+	}
+	if converter == nil || converter.ToDB == nil {
+		return value, nil
+	}
+	return converter.ToDB(value)
+}
+
+//fromDB converts src with converter into target
+func fromDB(target reflect.Value, src interface{}, converter *Converter) error {
+
+	//Drivers reuse their buffers from a row to the next
+	if b, ok := src.([]byte); ok {
+		src = append([]byte{}, b...)
+	}
+
+	value, err := converter.FromDB(src)
+	if err != nil {
+		return err
+	}
+
+	if value == nil {
+		target.Set(reflect.Zero(target.Type()))
+		return nil
+	}
+
+	converted := reflect.ValueOf(value)
+	if !converted.Type().ConvertibleTo(target.Type()) {
+		return fmt.Errorf("qw: converter returned %T for a %v field", value, target.Type())
+	}
+	target.Set(converted.Convert(target.Type()))
+	return nil
+}
+
+//jsonConverter returns the Converter of the fields of type t tagged
+//with the json option, stored as JSON documents
+func jsonConverter(t reflect.Type) *Converter {
+	return &Converter{
+		ToDB: func(value interface{}) (driver.Value, error) {
+			if value == nil {
+				return nil, nil
+			}
+			document, err := json.Marshal(value)
+			if err != nil {
+				return nil, err
+			}
+			return string(document), nil
+		},
+		FromDB: func(src interface{}) (interface{}, error) {
+			target := reflect.New(t)
+
+			var document []byte
+			switch value := src.(type) {
+			case nil:
+				return target.Elem().Interface(), nil
+			case []byte:
+				document = value
+			case string:
+				document = []byte(value)
+			default:
+				return nil, fmt.Errorf("qw: cannot decode %T as JSON", src)
+			}
+
+			err := json.Unmarshal(document, target.Interface())
+			return target.Elem().Interface(), err
+		},
+	}
+}
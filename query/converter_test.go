@@ -0,0 +1,149 @@
+package query
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+type Cents int64
+
+type Host struct {
+	ID     int    `db:"id"`
+	IP     net.IP `db:"ip,conv=inet"`
+	Budget Cents  `db:"budget"`
+}
+
+func init() {
+	RegisterType(Cents(0), Converter{
+		ToDB: func(value interface{}) (driver.Value, error) {
+			cents := value.(Cents)
+			if cents < 0 {
+				return nil, errors.New("negative budget")
+			}
+			return fmt.Sprintf("%d.%02d", cents/100, cents%100), nil
+		},
+		FromDB: func(src interface{}) (interface{}, error) {
+			amount, err := strconv.ParseFloat(string(src.([]byte)), 64)
+			return Cents(amount*100 + 0.5), err
+		},
+	})
+	RegisterConverter("inet", Converter{
+		ToDB: func(value interface{}) (driver.Value, error) {
+			return []byte(value.(net.IP).To16()), nil
+		},
+		FromDB: func(src interface{}) (interface{}, error) {
+			if src == nil {
+				return nil, nil
+			}
+			return net.IP(src.([]byte)), nil
+		},
+	})
+}
+
+func TestConverters(t *testing.T) {
+	s := []string{
+		"mock:mock@mock(127.0.0.1:3306)/mock",
+	}
+	cnx := new(CnxMock)
+	m, err := NewSQLQuery("hosts", s, cnx)
+
+	assert := assert.New(t)
+	assert.Nil(err)
+
+	ip := net.ParseIP("10.0.0.1")
+	cnx.Mock.ExpectPrepare(regexp.QuoteMeta("INSERT INTO hosts (ip, budget)  VALUES (?, ?)")).
+		ExpectExec().
+		WithArgs([]byte(ip.To16()), "12.34").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	cnx.Mock.ExpectPrepare(regexp.QuoteMeta("SELECT  *  FROM hosts WHERE budget > ?")).
+		ExpectQuery().
+		WithArgs("5.00").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "ip", "budget"}).
+			AddRow(1, []byte(ip.To16()), []byte("12.34")).
+			AddRow(2, nil, []byte("0.10")))
+
+	_, err = m.Insert(&Host{IP: ip, Budget: 1234})
+	assert.Nil(err)
+
+	_, err = m.Update(&Host{ID: 1, Budget: -1})
+	assert.Equal("negative budget", err.Error())
+
+	hosts, err := m.ReturnType(Host{}).WhereValue("budget >", Cents(500)).FindAll()
+	assert.Nil(err)
+	assert.Equal([]interface{}{Host{1, ip.To16(), 1234}, Host{2, nil, 10}}, hosts)
+
+	_, err = m.WhereValue("budget", Cents(-1)).FindAll()
+	assert.Equal("negative budget", err.Error())
+
+	type Unregistered struct {
+		ID  int    `db:"id"`
+		MAC string `db:"mac,conv=macaddr"`
+	}
+	_, err = m.Insert(&Unregistered{MAC: "00:00:5e:00:53:01"})
+	assert.Equal(`qw: no converter registered as "macaddr" on field MAC`, err.Error())
+	_, err = m.ReturnType(Unregistered{}).FindAll()
+	assert.Equal(`qw: no converter registered as "macaddr" on field MAC`, err.Error())
+
+	//Where inlines its value, converters left aside
+	assert.Equal("SELECT  *  FROM hosts WHERE budget = 500", m.Where("budget", "500").composeSelectString())
+	m.cleanup(nil)
+
+	assert.Nil(cnx.Mock.ExpectationsWereMet())
+}
+
+func TestJSONColumns(t *testing.T) {
+	s := []string{
+		"mock:mock@mock(127.0.0.1:3306)/mock",
+	}
+	cnx := new(CnxMock)
+	m, err := NewSQLQuery("events", s, cnx)
+
+	type Payload struct {
+		User  string `json:"user"`
+		Count int    `json:"count"`
+	}
+
+	type Event struct {
+		ID      int               `db:"id"`
+		Payload Payload           `db:"payload,json"`
+		Tags    []string          `db:"tags,json"`
+		Meta    map[string]string `db:"meta,json,omitempty"`
+	}
+
+	assert := assert.New(t)
+	assert.Nil(err)
+
+	cnx.Mock.ExpectPrepare(regexp.QuoteMeta("INSERT INTO events (payload, tags)  VALUES (?, ?)")).
+		ExpectExec().
+		WithArgs(`{"user":"bob","count":2}`, `["a","b"]`).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	cnx.Mock.ExpectPrepare(regexp.QuoteMeta("SELECT  *  FROM events WHERE JSON_UNQUOTE(JSON_EXTRACT(payload, '$.user')) = ?  AND JSON_UNQUOTE(JSON_EXTRACT(payload, '$.count')) > ?")).
+		ExpectQuery().
+		WithArgs("bob", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "payload", "tags", "meta"}).
+			AddRow(1, []byte(`{"user":"bob","count":2}`), []byte(`["a","b"]`), nil))
+
+	_, err = m.Insert(&Event{Payload: Payload{"bob", 2}, Tags: []string{"a", "b"}})
+	assert.Nil(err)
+
+	events, err := m.ReturnType(Event{}).
+		WhereJSON("payload.user", "=", "bob").
+		WhereJSON("payload.count", ">", 1).
+		FindAll()
+	assert.Nil(err)
+	assert.Equal([]interface{}{Event{1, Payload{"bob", 2}, []string{"a", "b"}, nil}}, events)
+
+	assert.Equal("payload->'user'->>'o''neil'", m.Dialect(Postgres).jsonExtract("payload.user.o'neil"))
+	assert.Equal("payload->>'user'", m.jsonExtract("payload.user"))
+	assert.Equal("json_extract(payload, '$.user')", m.Dialect(SQLite).jsonExtract("payload.user"))
+
+	assert.Nil(cnx.Mock.ExpectationsWereMet())
+}
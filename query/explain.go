@@ -0,0 +1,342 @@
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/mathieunls/qw/connector"
+)
+
+//OpExplain is the operation of the EXPLAIN statements. Middlewares,
+//logs and metrics see it, hooks don't
+const OpExplain Operation = "EXPLAIN"
+
+//ErrAnalyzeUnsupported is returned by ExplainAnalyze on the dialects
+//that can't analyze a statement
+var ErrAnalyzeUnsupported = errors.New("qw: EXPLAIN ANALYZE is not supported by the dialect")
+
+//PlanStep is a step of a query plan
+type PlanStep struct {
+
+	//The table read, empty for the steps reading none
+	Table string
+
+	//How the step reads: ALL, ref, ... on MySQL, Seq Scan, Index Scan,
+	//... on Postgres, SCAN or SEARCH on SQLite
+	Type string
+
+	//The index used, if any
+	Key string
+
+	//Rows the planner expects to read, 0 when the dialect tells none
+	Rows int64
+
+	//Rows actually read, ExplainAnalyze only
+	ActualRows int64
+
+	//What else the dialect says of the step
+	Detail string
+}
+
+//Plan is a query plan, outermost step first
+type Plan []PlanStep
+
+//FullTableScan returns whether the step reads a whole table
+func (step PlanStep) FullTableScan() bool {
+	switch step.Type {
+	case "ALL", "Table scan", "Seq Scan":
+		return true
+	case "SCAN":
+		return step.Key == ""
+	}
+	return false
+}
+
+//FullTableScans returns the steps of plan reading a whole table
+//plan, _ := model.Where("email", "a@b.c").Explain()
+//assert.Empty(t, plan.FullTableScans())
+func (plan Plan) FullTableScans() []PlanStep {
+	scans := []PlanStep{}
+	for index := 0; index < len(plan); index++ {
+		if plan[index].FullTableScan() {
+			scans = append(scans, plan[index])
+		}
+	}
+	return scans
+}
+
+//Explain returns the plan of the ongoing select, which doesn't run.
+//The model is cleaned up afterward
+func (model *SQLQuery) Explain() (Plan, error) {
+	return model.runExplain(false)
+}
+
+//ExplainAnalyze runs the ongoing select and returns its plan along with
+//the rows each step actually read. It isn't supported on SQLite.
+//The model is cleaned up afterward
+func (model *SQLQuery) ExplainAnalyze() (Plan, error) {
+	return model.runExplain(true)
+}
+
+//runExplain explains the ongoing select the way the dialect does
+func (model *SQLQuery) runExplain(analyze bool) (Plan, error) {
+
+	if err := model.checkPending(); err != nil {
+		model.cleanup(err)
+		return nil, err
+	}
+
+	explained, parse, err := model.explainOf(model.selectStatement(), analyze)
+	if err != nil {
+		model.cleanup(err)
+		return nil, err
+	}
+
+	ctx, done := model.track(explained)
+	columns, rows, err := model.explainRows(ctx, explained)
+	done(int64(len(rows)), err)
+
+	var plan Plan
+	if err == nil {
+		plan, err = parse(columns, rows)
+	}
+
+	model.cleanup(err)
+	return plan, err
+}
+
+//explainOf returns the statement explaining the select statement the
+//way the dialect does, along with the parser of its output
+func (model *SQLQuery) explainOf(statement *connector.Statement, analyze bool) (*connector.Statement, func(columns []string, rows [][]interface{}) (Plan, error), error) {
+
+	var prefix string
+	var parse func(columns []string, rows [][]interface{}) (Plan, error)
+	switch model.dialect {
+	case Postgres:
+		prefix, parse = "EXPLAIN (FORMAT JSON) ", parsePostgresPlan
+		if analyze {
+			prefix = "EXPLAIN (ANALYZE, FORMAT JSON) "
+		}
+	case SQLite:
+		if analyze {
+			return nil, nil, ErrAnalyzeUnsupported
+		}
+		prefix, parse = "EXPLAIN QUERY PLAN ", parseSQLitePlan
+	default:
+		prefix, parse = "EXPLAIN ", parseMySQLPlan
+		if analyze {
+			prefix, parse = "EXPLAIN ANALYZE ", parseMySQLTree
+		}
+	}
+
+	return &connector.Statement{
+		Operation: string(OpExplain),
+		Table:     statement.Table,
+		SQL:       prefix + statement.SQL,
+		Args:      statement.Args,
+	}, parse, nil
+}
+
+//explainRows runs the explained statement through the connection
+//middlewares and returns its rows as driver values
+func (model *SQLQuery) explainRows(ctx context.Context, explained *connector.Statement) ([]string, [][]interface{}, error) {
+
+	rows, err := model.queryRows(ctx, explained, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	values := [][]interface{}{}
+	for rows.Next() {
+		row, err := scanValues(rows, len(columns))
+		if err != nil {
+			return columns, values, err
+		}
+		values = append(values, row)
+	}
+	return columns, values, rows.Err()
+}
+
+//parseMySQLPlan reads the tabular output of a MySQL EXPLAIN
+func parseMySQLPlan(columns []string, rows [][]interface{}) (Plan, error) {
+	plan := Plan{}
+	for index := 0; index < len(rows); index++ {
+		row := make(map[string]interface{}, len(columns))
+		for c := 0; c < len(columns); c++ {
+			row[strings.ToLower(columns[c])] = rows[index][c]
+		}
+
+		plan = append(plan, PlanStep{
+			Table:  planString(row["table"]),
+			Type:   planString(row["type"]),
+			Key:    planString(row["key"]),
+			Rows:   planInt(row["rows"]),
+			Detail: planString(row["extra"]),
+		})
+	}
+	return plan, nil
+}
+
+//Pieces of the lines of a MySQL EXPLAIN ANALYZE tree, e.g.
+//-> Index lookup on bugs using idx_a (a=1)  (cost=0.35 rows=1) (actual time=0.02..0.02 rows=1 loops=1)
+var (
+	mysqlTreeType   = regexp.MustCompile(`^-> (.+?)(:| on |  \(|$)`)
+	mysqlTreeTable  = regexp.MustCompile(` on (\S+)`)
+	mysqlTreeKey    = regexp.MustCompile(` using (\S+)`)
+	mysqlTreeRows   = regexp.MustCompile(`\(cost=[^)]*rows=([0-9.e+]+)`)
+	mysqlTreeActual = regexp.MustCompile(`\(actual time=[^)]*rows=([0-9.e+]+)`)
+)
+
+//parseMySQLTree reads the tree a MySQL EXPLAIN ANALYZE returns
+func parseMySQLTree(columns []string, rows [][]interface{}) (Plan, error) {
+	plan := Plan{}
+	for index := 0; index < len(rows); index++ {
+		if len(rows[index]) == 0 {
+			continue
+		}
+		lines := strings.Split(planString(rows[index][0]), "\n")
+
+		for l := 0; l < len(lines); l++ {
+			line := strings.TrimSpace(lines[l])
+			match := mysqlTreeType.FindStringSubmatch(line)
+			if match == nil {
+				continue
+			}
+
+			plan = append(plan, PlanStep{
+				Table:      submatch(mysqlTreeTable, line),
+				Type:       match[1],
+				Key:        submatch(mysqlTreeKey, line),
+				Rows:       planInt(submatch(mysqlTreeRows, line)),
+				ActualRows: planInt(submatch(mysqlTreeActual, line)),
+				Detail:     strings.TrimPrefix(line, "-> "),
+			})
+		}
+	}
+	return plan, nil
+}
+
+//postgresNode is a node of a Postgres JSON plan
+type postgresNode struct {
+	NodeType     string         `json:"Node Type"`
+	RelationName string         `json:"Relation Name"`
+	IndexName    string         `json:"Index Name"`
+	PlanRows     float64        `json:"Plan Rows"`
+	ActualRows   float64        `json:"Actual Rows"`
+	Filter       string         `json:"Filter"`
+	Plans        []postgresNode `json:"Plans"`
+}
+
+//parsePostgresPlan reads the JSON a Postgres EXPLAIN returns
+func parsePostgresPlan(columns []string, rows [][]interface{}) (Plan, error) {
+	plan := Plan{}
+	for index := 0; index < len(rows); index++ {
+		if len(rows[index]) == 0 {
+			continue
+		}
+
+		var explained []struct {
+			Plan postgresNode `json:"Plan"`
+		}
+		if err := json.Unmarshal([]byte(planString(rows[index][0])), &explained); err != nil {
+			return plan, fmt.Errorf("qw: unreadable Postgres plan: %v", err)
+		}
+		for e := 0; e < len(explained); e++ {
+			plan = appendPostgresNode(plan, explained[e].Plan)
+		}
+	}
+	return plan, nil
+}
+
+//appendPostgresNode appends node then its children to plan
+func appendPostgresNode(plan Plan, node postgresNode) Plan {
+	plan = append(plan, PlanStep{
+		Table:      node.RelationName,
+		Type:       node.NodeType,
+		Key:        node.IndexName,
+		Rows:       int64(node.PlanRows),
+		ActualRows: int64(node.ActualRows),
+		Detail:     node.Filter,
+	})
+	for index := 0; index < len(node.Plans); index++ {
+		plan = appendPostgresNode(plan, node.Plans[index])
+	}
+	return plan
+}
+
+//sqliteDetail splits the detail of a SQLite EXPLAIN QUERY PLAN row, e.g.
+//SEARCH TABLE bugs USING INDEX idx_a (a=?)
+var (
+	sqliteDetail = regexp.MustCompile(`^(SCAN|SEARCH)(?: TABLE)? (\S+)`)
+	sqliteKey    = regexp.MustCompile(`USING (?:COVERING )?INDEX (\S+)|USING (INTEGER PRIMARY KEY)`)
+)
+
+//parseSQLitePlan reads the rows of a SQLite EXPLAIN QUERY PLAN
+func parseSQLitePlan(columns []string, rows [][]interface{}) (Plan, error) {
+	plan := Plan{}
+	for index := 0; index < len(rows); index++ {
+		if len(rows[index]) == 0 {
+			continue
+		}
+		detail := planString(rows[index][len(rows[index])-1])
+
+		step := PlanStep{Type: detail, Detail: detail}
+		if match := sqliteDetail.FindStringSubmatch(detail); match != nil {
+			step.Type, step.Table = match[1], match[2]
+		}
+		if match := sqliteKey.FindStringSubmatch(detail); match != nil {
+			step.Key = match[1] + match[2]
+		}
+		plan = append(plan, step)
+	}
+	return plan, nil
+}
+
+//submatch returns the first group of re in s, empty if it doesn't match
+func submatch(re *regexp.Regexp, s string) string {
+	if match := re.FindStringSubmatch(s); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+//planString reads a plan value as a string, empty for NULL
+func planString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	}
+	return fmt.Sprint(value)
+}
+
+//planInt reads a plan value as an integer, 0 if it isn't one
+func planInt(value interface{}) int64 {
+	switch v := value.(type) {
+	case int64:
+		return v
+	case float64:
+		return int64(v)
+	case string:
+		f, _ := strconv.ParseFloat(v, 64)
+		return int64(f)
+	case []byte:
+		f, _ := strconv.ParseFloat(string(v), 64)
+		return int64(f)
+	}
+	return 0
+}
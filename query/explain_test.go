@@ -0,0 +1,138 @@
+package query
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/mathieunls/qw/connector"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExplain(t *testing.T) {
+	s := []string{
+		"mock:mock@mock(127.0.0.1:3306)/mock",
+	}
+	cnx := new(CnxMock)
+	m, err := NewSQLQuery("bugs", s, cnx)
+
+	assert := assert.New(t)
+	assert.Nil(err)
+
+	cnx.Mock.ExpectQuery(regexp.QuoteMeta("EXPLAIN SELECT  *  FROM bugs JOIN  users ON users.id = bugs.user_id WHERE name = ?")).
+		WithArgs("crash").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "select_type", "table", "type", "key", "rows", "Extra"}).
+			AddRow(1, "SIMPLE", "bugs", "ALL", nil, "1000", "Using where").
+			AddRow(1, "SIMPLE", "users", "eq_ref", "PRIMARY", "1", nil))
+
+	plan, err := m.Join("users", "users.id = bugs.user_id", "").WhereValue("name", "crash").Explain()
+	assert.Nil(err)
+	assert.Equal(Plan{
+		{Table: "bugs", Type: "ALL", Rows: 1000, Detail: "Using where"},
+		{Table: "users", Type: "eq_ref", Key: "PRIMARY", Rows: 1},
+	}, plan)
+	assert.Equal([]PlanStep{plan[0]}, plan.FullTableScans())
+	assert.Empty(m.pendingWheres, "should be empty")
+
+	cnx.Mock.ExpectQuery(regexp.QuoteMeta("EXPLAIN ANALYZE SELECT  *  FROM bugs WHERE a = 1")).
+		WillReturnRows(sqlmock.NewRows([]string{"EXPLAIN"}).AddRow(
+			"-> Filter: (bugs.a = 1)  (cost=101 rows=100) (actual time=0.03..0.5 rows=12 loops=1)\n" +
+				"    -> Table scan on bugs  (cost=101 rows=1000) (actual time=0.02..0.4 rows=1000 loops=1)\n"))
+	cnx.Mock.ExpectQuery(regexp.QuoteMeta("EXPLAIN ANALYZE SELECT  *  FROM bugs WHERE b = 1")).
+		WillReturnRows(sqlmock.NewRows([]string{"EXPLAIN"}).AddRow(
+			"-> Index lookup on bugs using idx_b (b=1)  (cost=0.35 rows=1) (actual time=0.02..0.02 rows=1 loops=1)\n"))
+
+	plan, err = m.Where("a", "1").ExplainAnalyze()
+	assert.Nil(err)
+	assert.Equal(Plan{
+		{Type: "Filter", Rows: 100, ActualRows: 12, Detail: "Filter: (bugs.a = 1)  (cost=101 rows=100) (actual time=0.03..0.5 rows=12 loops=1)"},
+		{Table: "bugs", Type: "Table scan", Rows: 1000, ActualRows: 1000, Detail: "Table scan on bugs  (cost=101 rows=1000) (actual time=0.02..0.4 rows=1000 loops=1)"},
+	}, plan)
+	assert.Len(plan.FullTableScans(), 1)
+
+	plan, err = m.Where("b", "1").ExplainAnalyze()
+	assert.Nil(err)
+	assert.Equal("idx_b", plan[0].Key)
+	assert.Empty(plan.FullTableScans())
+
+	assert.Nil(cnx.Mock.ExpectationsWereMet())
+}
+
+func TestExplainDialects(t *testing.T) {
+	s := []string{
+		"mock:mock@mock(127.0.0.1:3306)/mock",
+	}
+	cnx := new(CnxMock)
+	m, err := NewSQLQuery("bugs", s, cnx)
+
+	assert := assert.New(t)
+	assert.Nil(err)
+
+	cnx.Mock.ExpectQuery(regexp.QuoteMeta("EXPLAIN (ANALYZE, FORMAT JSON) SELECT  *  FROM bugs WHERE a = 1")).
+		WillReturnRows(sqlmock.NewRows([]string{"QUERY PLAN"}).AddRow([]byte(`[{"Plan": {
+			"Node Type": "Nested Loop", "Plan Rows": 5, "Actual Rows": 4, "Plans": [
+				{"Node Type": "Seq Scan", "Relation Name": "bugs", "Filter": "(a = 1)", "Plan Rows": 5, "Actual Rows": 4},
+				{"Node Type": "Index Scan", "Relation Name": "users", "Index Name": "users_pkey", "Plan Rows": 1, "Actual Rows": 1}
+			]}}]`)))
+
+	plan, err := m.Dialect(Postgres).Where("a", "1").ExplainAnalyze()
+	assert.Nil(err)
+	assert.Equal(Plan{
+		{Type: "Nested Loop", Rows: 5, ActualRows: 4},
+		{Table: "bugs", Type: "Seq Scan", Rows: 5, ActualRows: 4, Detail: "(a = 1)"},
+		{Table: "users", Type: "Index Scan", Key: "users_pkey", Rows: 1, ActualRows: 1},
+	}, plan)
+	assert.Equal("bugs", plan.FullTableScans()[0].Table)
+
+	cnx.Mock.ExpectQuery(regexp.QuoteMeta("EXPLAIN QUERY PLAN SELECT  *  FROM bugs")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "parent", "notused", "detail"}).
+			AddRow(2, 0, 0, "SCAN bugs").
+			AddRow(3, 0, 0, "SEARCH TABLE users USING INTEGER PRIMARY KEY (rowid=?)").
+			AddRow(4, 0, 0, "SCAN tags USING COVERING INDEX idx_tags"))
+
+	plan, err = m.Dialect(SQLite).Explain()
+	assert.Nil(err)
+	assert.Equal([]string{"", "INTEGER PRIMARY KEY", "idx_tags"}, []string{plan[0].Key, plan[1].Key, plan[2].Key})
+	assert.Equal([]string{"bugs", "users", "tags"}, []string{plan[0].Table, plan[1].Table, plan[2].Table})
+	assert.Equal([]PlanStep{plan[0]}, plan.FullTableScans())
+
+	_, err = m.ExplainAnalyze()
+	assert.Equal(ErrAnalyzeUnsupported, err)
+
+	assert.Nil(cnx.Mock.ExpectationsWereMet())
+}
+
+func TestExplainMiddlewares(t *testing.T) {
+	s := []string{
+		"mock:mock@mock(127.0.0.1:3306)/mock",
+	}
+
+	seen := []string{}
+	record := func(next connector.Exec) connector.Exec {
+		return func(ctx context.Context, statement *connector.Statement) error {
+			seen = append(seen, statement.Operation+" "+statement.Table)
+			return next(ctx, statement)
+		}
+	}
+
+	cnx := new(CnxMock)
+	m, err := NewSQLQuery("bugs", s, connector.Use(cnx, record))
+	metrics := NewMetrics()
+
+	assert := assert.New(t)
+	assert.Nil(err)
+
+	cnx.Mock.ExpectQuery(regexp.QuoteMeta("EXPLAIN (FORMAT JSON) SELECT  *  FROM bugs WHERE name = $1")).
+		WithArgs("crash").
+		WillReturnRows(sqlmock.NewRows([]string{"QUERY PLAN"}).AddRow(`[{"Plan": {"Node Type": "Seq Scan", "Relation Name": "bugs"}}]`))
+
+	plan, err := m.Dialect(Postgres).Collector(metrics).WhereValue("name", "crash").Explain()
+	assert.Nil(err)
+	assert.Equal(Plan{{Table: "bugs", Type: "Seq Scan"}}, plan)
+	assert.Equal([]string{"EXPLAIN bugs"}, seen)
+	assert.Equal("EXPLAIN (FORMAT JSON) SELECT  *  FROM bugs WHERE name = $1", m.LastQuery())
+	assert.Equal(int64(1), metrics.series[seriesKey{"bugs", "EXPLAIN"}].queries)
+
+	assert.Nil(cnx.Mock.ExpectationsWereMet())
+}
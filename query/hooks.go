@@ -0,0 +1,171 @@
+package query
+
+import "sort"
+
+//Event names the moment a hook is called at
+type Event string
+
+//Events hooks can be registered for
+const (
+	EventBeforeInsert Event = "beforeInsert"
+	EventAfterInsert  Event = "afterInsert"
+	EventBeforeUpdate Event = "beforeUpdate"
+	EventAfterUpdate  Event = "afterUpdate"
+	EventBeforeFind   Event = "beforeFind"
+	EventAfterFind    Event = "afterFind"
+	EventBeforeDelete Event = "beforeDelete"
+	EventAfterDelete  Event = "afterDelete"
+)
+
+//handler is a registered hook
+type handler struct {
+	hook     Hook
+	name     string
+	priority int
+}
+
+//HookOption tunes the registration of a hook
+type HookOption func(*handler)
+
+//Priority orders the hooks of an event: lower priorities run first,
+//hooks of the same priority run in registration order. The default is 0
+func Priority(priority int) HookOption {
+	return func(h *handler) {
+		h.priority = priority
+	}
+}
+
+//Named names a hook so it can be removed with RemoveHook.
+//Registering a name again replaces the previous hook
+func Named(name string) HookOption {
+	return func(h *handler) {
+		h.name = name
+	}
+}
+
+//handlersOf returns the hooks registered for event
+func (model *SQLQuery) handlersOf(event Event) *[]*handler {
+	switch event {
+	case EventBeforeInsert:
+		return &model.beforeInsert
+	case EventAfterInsert:
+		return &model.afterInsert
+	case EventBeforeUpdate:
+		return &model.beforeUpdate
+	case EventAfterUpdate:
+		return &model.afterUpdate
+	case EventBeforeFind:
+		return &model.beforeFind
+	case EventAfterFind:
+		return &model.afterFind
+	case EventBeforeDelete:
+		return &model.beforeDelete
+	case EventAfterDelete:
+		return &model.afterDelete
+	}
+	return nil
+}
+
+//On adds hook to the ones of event, keeping those already registered.
+//The returned func unregisters it
+//unregister := model.On(EventAfterUpdate, audit, Named("audit"), Priority(10))
+func (model *SQLQuery) On(event Event, hook Hook, options ...HookOption) (unregister func()) {
+	handlers := model.handlersOf(event)
+	if handlers == nil {
+		return func() {}
+	}
+
+	h := &handler{hook: hook}
+	for index := 0; index < len(options); index++ {
+		options[index](h)
+	}
+	if h.name != "" {
+		model.RemoveHook(event, h.name)
+	}
+
+	*handlers = append(*handlers, h)
+	sort.SliceStable(*handlers, func(i, j int) bool {
+		return (*handlers)[i].priority < (*handlers)[j].priority
+	})
+
+	return func() {
+		model.removeHandlers(event, func(registered *handler) bool {
+			return registered == h
+		})
+	}
+}
+
+//RemoveHook unregisters the hook of event registered under name.
+//It returns false if there was none
+func (model *SQLQuery) RemoveHook(event Event, name string) bool {
+	return model.removeHandlers(event, func(registered *handler) bool {
+		return registered.name == name
+	})
+}
+
+//removeHandlers drops the hooks of event matching match
+func (model *SQLQuery) removeHandlers(event Event, match func(*handler) bool) bool {
+	handlers := model.handlersOf(event)
+	if handlers == nil {
+		return false
+	}
+
+	kept := []*handler{}
+	for index := 0; index < len(*handlers); index++ {
+		if !match((*handlers)[index]) {
+			kept = append(kept, (*handlers)[index])
+		}
+	}
+	removed := len(kept) != len(*handlers)
+	*handlers = kept
+	return removed
+}
+
+//setHooks replaces the hooks of event by triggers
+func (model *SQLQuery) setHooks(event Event, triggers []Hook) *SQLQuery {
+	*model.handlersOf(event) = nil
+	for index := 0; index < len(triggers); index++ {
+		model.On(event, triggers[index])
+	}
+	return model
+}
+
+//OnBeforeInsert adds a BeforeInsert hook, see On
+func (model *SQLQuery) OnBeforeInsert(hook Hook, options ...HookOption) (unregister func()) {
+	return model.On(EventBeforeInsert, hook, options...)
+}
+
+//OnAfterInsert adds an AfterInsert hook, see On
+func (model *SQLQuery) OnAfterInsert(hook Hook, options ...HookOption) (unregister func()) {
+	return model.On(EventAfterInsert, hook, options...)
+}
+
+//OnBeforeUpdate adds a BeforeUpdate hook, see On
+func (model *SQLQuery) OnBeforeUpdate(hook Hook, options ...HookOption) (unregister func()) {
+	return model.On(EventBeforeUpdate, hook, options...)
+}
+
+//OnAfterUpdate adds an AfterUpdate hook, see On
+func (model *SQLQuery) OnAfterUpdate(hook Hook, options ...HookOption) (unregister func()) {
+	return model.On(EventAfterUpdate, hook, options...)
+}
+
+//OnBeforeFind adds a BeforeFind hook, see On
+func (model *SQLQuery) OnBeforeFind(hook Hook, options ...HookOption) (unregister func()) {
+	return model.On(EventBeforeFind, hook, options...)
+}
+
+//OnAfterFind adds an AfterFind hook, see On
+func (model *SQLQuery) OnAfterFind(hook Hook, options ...HookOption) (unregister func()) {
+	return model.On(EventAfterFind, hook, options...)
+}
+
+//OnBeforeDelete adds a BeforeDelete hook, see On
+func (model *SQLQuery) OnBeforeDelete(hook Hook, options ...HookOption) (unregister func()) {
+	return model.On(EventBeforeDelete, hook, options...)
+}
+
+//OnAfterDelete adds an AfterDelete hook, see On
+func (model *SQLQuery) OnAfterDelete(hook Hook, options ...HookOption) (unregister func()) {
+	return model.On(EventAfterDelete, hook, options...)
+}
@@ -0,0 +1,57 @@
+package query
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHookRegistration(t *testing.T) {
+	s := []string{
+		"mock:mock@mock(127.0.0.1:3306)/mock",
+	}
+	m, err := NewSQLQuery("bugs", s, new(CnxMock))
+
+	assert := assert.New(t)
+	assert.Nil(err)
+
+	calls := []string{}
+	hook := func(name string) Hook {
+		return func(ctx context.Context, event *HookEvent) error {
+			calls = append(calls, name)
+			return nil
+		}
+	}
+	run := func() []string {
+		calls = []string{}
+		assert.Nil(m.executeafterUpdate(&HookEvent{}))
+		return calls
+	}
+
+	m.AfterUpdate([]Hook{hook("legacy")})
+	unregister := m.OnAfterUpdate(hook("audit"))
+	m.OnAfterUpdate(hook("first"), Priority(-1))
+	m.OnAfterUpdate(hook("cache"), Named("cache"), Priority(5))
+	assert.Equal([]string{"first", "legacy", "audit", "cache"}, run())
+
+	//Registering a name again replaces the hook
+	m.OnAfterUpdate(hook("cache v2"), Named("cache"))
+	assert.Equal([]string{"first", "legacy", "audit", "cache v2"}, run())
+
+	unregister()
+	unregister()
+	assert.True(m.RemoveHook(EventAfterUpdate, "cache"))
+	assert.False(m.RemoveHook(EventAfterUpdate, "cache"))
+	assert.Equal([]string{"first", "legacy"}, run())
+
+	//Other events are left alone
+	m.OnBeforeDelete(hook("delete"))
+	assert.Equal([]string{"first", "legacy"}, run())
+
+	//The legacy setters still replace every hook of the event
+	m.AfterUpdate([]Hook{hook("only")})
+	assert.Equal([]string{"only"}, run())
+	m.AfterUpdate(nil)
+	assert.Empty(run())
+}
@@ -0,0 +1,154 @@
+package query
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+//keyGenerators holds the client-side key generators usable with the
+//gen tag option
+//	ID string `db:"id,pk,gen=uuidv7"`
+var keyGenerators = map[string]func() ([16]byte, error){
+	"uuid":   newUUIDv4,
+	"uuidv4": newUUIDv4,
+	"uuidv7": newUUIDv7,
+	"ulid":   newULID,
+}
+
+//crockford is the base32 alphabet of ULIDs
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+//UUIDv4 returns a random UUID.
+//It panics if the system random source fails
+func UUIDv4() string {
+	return formatUUID(mustGenerate(newUUIDv4))
+}
+
+//UUIDv7 returns a time ordered UUID.
+//It panics if the system random source fails
+func UUIDv7() string {
+	return formatUUID(mustGenerate(newUUIDv7))
+}
+
+//ULID returns a time ordered, lexicographically sortable identifier.
+//It panics if the system random source fails
+func ULID() string {
+	return formatULID(mustGenerate(newULID))
+}
+
+//mustGenerate returns the id made by generate, panicking on error
+func mustGenerate(generate func() ([16]byte, error)) [16]byte {
+	id, err := generate()
+	if err != nil {
+		panic(err)
+	}
+	return id
+}
+
+//newUUIDv4 returns the bytes of a random UUID
+func newUUIDv4() ([16]byte, error) {
+	var uuid [16]byte
+	if _, err := rand.Read(uuid[:]); err != nil {
+		return uuid, err
+	}
+	uuid[6] = (uuid[6] & 0x0f) | 0x40
+	uuid[8] = (uuid[8] & 0x3f) | 0x80
+	return uuid, nil
+}
+
+//newUUIDv7 returns the bytes of a UUID starting with the unix time in ms
+func newUUIDv7() ([16]byte, error) {
+	uuid, err := newTimestamped()
+	uuid[6] = (uuid[6] & 0x0f) | 0x70
+	uuid[8] = (uuid[8] & 0x3f) | 0x80
+	return uuid, err
+}
+
+//newULID returns the bytes of a ULID
+func newULID() ([16]byte, error) {
+	return newTimestamped()
+}
+
+//newTimestamped returns 48 bits of unix time in ms followed by 80
+//random bits
+func newTimestamped() ([16]byte, error) {
+	var id [16]byte
+	var ms [8]byte
+	binary.BigEndian.PutUint64(ms[:], uint64(time.Now().UnixNano()/int64(time.Millisecond)))
+	copy(id[:6], ms[2:])
+	_, err := rand.Read(id[6:])
+	return id, err
+}
+
+//formatUUID returns the canonical 8-4-4-4-12 form of uuid
+func formatUUID(uuid [16]byte) string {
+	buf := make([]byte, 36)
+	hex.Encode(buf[0:8], uuid[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], uuid[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], uuid[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], uuid[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], uuid[10:])
+	return string(buf)
+}
+
+//formatULID returns the 26 characters Crockford base32 form of id
+func formatULID(id [16]byte) string {
+	hi := binary.BigEndian.Uint64(id[:8])
+	lo := binary.BigEndian.Uint64(id[8:])
+
+	buf := make([]byte, 26)
+	for index := 25; index >= 0; index-- {
+		buf[index] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(buf)
+}
+
+//checkGenerator returns why the key generator name can't fill fields
+//of type t, nil if it can
+func checkGenerator(t reflect.Type, name string) error {
+	if _, ok := keyGenerators[name]; !ok {
+		return fmt.Errorf("qw: unknown key generator %q", name)
+	}
+	if t.Kind() != reflect.String && !isRawID(t) {
+		return fmt.Errorf("qw: key generator %q can't fill a %v field", name, t)
+	}
+	return nil
+}
+
+//isRawID returns whether t holds the raw 16 bytes of an id
+func isRawID(t reflect.Type) bool {
+	return t.Kind() == reflect.Array && t.Len() == 16 && t.Elem().Kind() == reflect.Uint8
+}
+
+//generateKey fills the zero field with a key made by generator,
+//formatted as a string or kept as raw bytes for [16]byte fields
+func generateKey(target reflect.Value, generator string) error {
+	if err := checkGenerator(target.Type(), generator); err != nil || !target.IsZero() {
+		return err
+	}
+
+	id, err := keyGenerators[generator]()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case target.Kind() == reflect.String && generator == "ulid":
+		target.SetString(formatULID(id))
+	case target.Kind() == reflect.String:
+		target.SetString(formatUUID(id))
+	default:
+		reflect.Copy(target, reflect.ValueOf(id[:]))
+	}
+	return nil
+}
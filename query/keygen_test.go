@@ -0,0 +1,133 @@
+package query
+
+import (
+	"regexp"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyGenerators(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Regexp("^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$", UUIDv4())
+	assert.Regexp("^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$", UUIDv7())
+	assert.Regexp("^[0-7][0-9A-HJKMNP-TV-Z]{25}$", ULID())
+	assert.NotEqual(UUIDv4(), UUIDv4())
+
+	assert.Equal("00000000-0000-0000-0000-000000000001", formatUUID([16]byte{15: 1}))
+	assert.Equal("00000000000000000000000001", formatULID([16]byte{15: 1}))
+	assert.Equal("7ZZZZZZZZZZZZZZZZZZZZZZZZZ", formatULID([16]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}))
+}
+
+func TestNonIntegerKeys(t *testing.T) {
+	s := []string{
+		"mock:mock@mock(127.0.0.1:3306)/mock",
+	}
+	cnx := new(CnxMock)
+	m, err := NewSQLQuery("tickets", s, cnx)
+
+	type Ticket struct {
+		ID    string `db:"id,pk,gen=uuidv7"`
+		Title string `db:"title"`
+	}
+
+	type Raw struct {
+		ID [16]byte `db:"id,pk,gen=ulid"`
+	}
+
+	type Line struct {
+		Project string `db:"project"`
+		Number  uint   `db:"number"`
+		Label   string `db:"label"`
+	}
+
+	assert := assert.New(t)
+	assert.Nil(err)
+
+	cnx.Mock.ExpectPrepare(regexp.QuoteMeta("INSERT INTO tickets (id, title)  VALUES (?, ?)")).
+		ExpectExec().
+		WithArgs(sqlmock.AnyArg(), "crash").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	cnx.Mock.ExpectPrepare(regexp.QuoteMeta("INSERT INTO tickets (id)  VALUES (?)")).
+		ExpectExec().
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	cnx.Mock.ExpectPrepare(regexp.QuoteMeta("DELETE FROM tickets WHERE id = ?")).
+		ExpectExec().
+		WithArgs("abc").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	cnx.Mock.ExpectPrepare(regexp.QuoteMeta("UPDATE tickets SET label = ? WHERE project = ? AND number = ?")).
+		ExpectExec().
+		WithArgs("l", "qw", uint(42)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	cnx.Mock.ExpectPrepare(regexp.QuoteMeta("SELECT  *  FROM tickets WHERE project = ?  AND number = ? LIMIT 1")).
+		ExpectQuery().
+		WithArgs("qw", 42).
+		WillReturnRows(sqlmock.NewRows([]string{"project", "number", "label"}).AddRow("qw", 42, "l"))
+	cnx.Mock.ExpectPrepare(regexp.QuoteMeta("SELECT  *  FROM tickets WHERE project = ?  AND number = ? LIMIT 1")).
+		ExpectQuery().
+		WithArgs("qw", 43).
+		WillReturnRows(sqlmock.NewRows([]string{"project", "number", "label"}))
+
+	ticket := &Ticket{Title: "crash"}
+	_, err = m.Insert(ticket)
+	assert.Nil(err)
+	assert.Regexp("^[0-9a-f]{8}-[0-9a-f]{4}-7", ticket.ID)
+
+	raw := &Raw{}
+	_, err = m.Insert(raw)
+	assert.Nil(err)
+	assert.NotEqual([16]byte{}, raw.ID)
+
+	_, err = m.Delete(&Ticket{ID: "abc"})
+	assert.Nil(err)
+
+	m.Key("project", "number")
+	_, err = m.Update(&Line{"qw", 42, "l"})
+	assert.Nil(err)
+
+	m.returnType = new(Line)
+	line, err := m.Find("qw", 42)
+	assert.Nil(err)
+	assert.Equal(Line{"qw", 42, "l"}, line)
+
+	_, err = m.Find([]interface{}{"qw", 43})
+	assert.Equal("sql: no rows in result set", err.Error())
+
+	_, err = m.Find("qw")
+	assert.Equal("qw: Find expects 2 key values, got 1", err.Error())
+
+	assert.Nil(cnx.Mock.ExpectationsWereMet())
+}
+
+func TestKeyGeneratorErrors(t *testing.T) {
+	s := []string{
+		"mock:mock@mock(127.0.0.1:3306)/mock",
+	}
+	cnx := new(CnxMock)
+	m, err := NewSQLQuery("tickets", s, cnx)
+
+	type Unknown struct {
+		ID string `db:"id,pk,gen=uuidv9"`
+	}
+
+	type Counter struct {
+		ID int `db:"id,pk,gen=uuid"`
+	}
+
+	assert := assert.New(t)
+	assert.Nil(err)
+
+	_, err = m.Insert(&Unknown{})
+	assert.Equal(`qw: unknown key generator "uuidv9" on field ID`, err.Error())
+
+	_, err = m.Insert(&Counter{})
+	assert.Equal(`qw: key generator "uuid" can't fill a int field on field ID`, err.Error())
+
+	m.returnType = new(Counter)
+	_, err = m.FindAll()
+	assert.NotNil(err)
+
+	assert.Nil(cnx.Mock.ExpectationsWereMet())
+}
@@ -0,0 +1,105 @@
+package query
+
+import (
+	"context"
+	"reflect"
+)
+
+//Structs opt in the lifecycle of their own rows by implementing the
+//interfaces below, wherever the model they go through comes from.
+//Their methods run before the hooks registered on the model; an error
+//aborts the operation like a hook error does
+
+//Validator is checked before the struct is inserted or updated
+type Validator interface {
+	Validate() error
+}
+
+//BeforeInserter is called before the struct is inserted
+type BeforeInserter interface {
+	BeforeInsert(ctx context.Context) error
+}
+
+//AfterInserter is called once the struct is inserted
+type AfterInserter interface {
+	AfterInsert(ctx context.Context) error
+}
+
+//BeforeUpdater is called before the struct is updated
+type BeforeUpdater interface {
+	BeforeUpdate(ctx context.Context) error
+}
+
+//AfterUpdater is called once the struct is updated
+type AfterUpdater interface {
+	AfterUpdate(ctx context.Context) error
+}
+
+//BeforeDeleter is called before the struct is deleted
+type BeforeDeleter interface {
+	BeforeDelete(ctx context.Context) error
+}
+
+//AfterDeleter is called once the struct is deleted
+type AfterDeleter interface {
+	AfterDelete(ctx context.Context) error
+}
+
+//AfterFinder is called on each struct read from the db
+type AfterFinder interface {
+	AfterFind(ctx context.Context) error
+}
+
+//beforeLifecycle calls the Validate and Before methods of data
+//matching operation
+func beforeLifecycle(ctx context.Context, operation Operation, data interface{}) error {
+	if validator, ok := data.(Validator); ok && (operation == OpInsert || operation == OpUpdate) {
+		if err := validator.Validate(); err != nil {
+			return err
+		}
+	}
+
+	switch operation {
+	case OpInsert:
+		if inserter, ok := data.(BeforeInserter); ok {
+			return inserter.BeforeInsert(ctx)
+		}
+	case OpUpdate:
+		if updater, ok := data.(BeforeUpdater); ok {
+			return updater.BeforeUpdate(ctx)
+		}
+	case OpDelete:
+		if deleter, ok := data.(BeforeDeleter); ok {
+			return deleter.BeforeDelete(ctx)
+		}
+	}
+	return nil
+}
+
+//afterLifecycle calls the After method of data matching operation
+func afterLifecycle(ctx context.Context, operation Operation, data interface{}) error {
+	switch operation {
+	case OpInsert:
+		if inserter, ok := data.(AfterInserter); ok {
+			return inserter.AfterInsert(ctx)
+		}
+	case OpUpdate:
+		if updater, ok := data.(AfterUpdater); ok {
+			return updater.AfterUpdate(ctx)
+		}
+	case OpDelete:
+		if deleter, ok := data.(AfterDeleter); ok {
+			return deleter.AfterDelete(ctx)
+		}
+	}
+	return nil
+}
+
+//afterFind calls the AfterFind method of a freshly read struct,
+//whatever the receiver it is declared on
+func afterFind(ctx context.Context, reflected reflect.Value) error {
+	if finder, ok := reflected.Addr().Interface().(AfterFinder); ok {
+		return finder.AfterFind(ctx)
+	}
+	return nil
+}
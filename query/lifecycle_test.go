@@ -0,0 +1,91 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+type Ticket struct {
+	ID    int    `db:"id"`
+	Title string `db:"title"`
+	Slug  string `db:"slug"`
+
+	calls []string
+}
+
+func (ticket *Ticket) Validate() error {
+	if ticket.Title == "" {
+		return errors.New("title is mandatory")
+	}
+	return nil
+}
+
+func (ticket *Ticket) BeforeInsert(ctx context.Context) error {
+	ticket.calls = append(ticket.calls, "BeforeInsert")
+	ticket.Slug = strings.ToLower(ticket.Title)
+	return nil
+}
+
+func (ticket *Ticket) AfterInsert(ctx context.Context) error {
+	ticket.calls = append(ticket.calls, "AfterInsert")
+	return nil
+}
+
+func (ticket *Ticket) BeforeDelete(ctx context.Context) error {
+	return errors.New("tickets are never deleted")
+}
+
+func (ticket *Ticket) AfterFind(ctx context.Context) error {
+	ticket.Title = strings.ToUpper(ticket.Title)
+	return nil
+}
+
+func TestLifecycle(t *testing.T) {
+	s := []string{
+		"mock:mock@mock(127.0.0.1:3306)/mock",
+	}
+	cnx := new(CnxMock)
+	m, err := NewSQLQuery("tickets", s, cnx)
+	m.returnType = new(Ticket)
+
+	assert := assert.New(t)
+	assert.Nil(err)
+
+	m.OnBeforeInsert(func(ctx context.Context, event *HookEvent) error {
+		event.Rows[0].(*Ticket).calls = append(event.Rows[0].(*Ticket).calls, "hook")
+		return nil
+	})
+
+	_, err = m.Insert(&Ticket{})
+	assert.Equal("title is mandatory", err.Error())
+
+	cnx.Mock.ExpectPrepare(regexp.QuoteMeta("INSERT INTO tickets (title, slug)  VALUES (?, ?)")).
+		ExpectExec().
+		WithArgs("Crash", "crash").
+		WillReturnResult(sqlmock.NewResult(3, 1))
+	cnx.Mock.ExpectPrepare(regexp.QuoteMeta("SELECT  *  FROM tickets")).
+		ExpectQuery().
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "slug"}).AddRow(3, "Crash", "crash"))
+
+	ticket := &Ticket{Title: "Crash"}
+	inserted, err := m.Insert(ticket)
+	assert.Nil(err)
+	assert.True(inserted)
+	assert.Equal(3, ticket.ID)
+	assert.Equal([]string{"BeforeInsert", "hook", "AfterInsert"}, ticket.calls)
+
+	_, err = m.Delete(ticket)
+	assert.Equal("tickets are never deleted", err.Error())
+
+	tickets, err := m.FindAll()
+	assert.Nil(err)
+	assert.Equal("CRASH", tickets[0].(Ticket).Title)
+
+	assert.Nil(cnx.Mock.ExpectationsWereMet())
+}
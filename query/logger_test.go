@@ -0,0 +1,69 @@
+package query
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/mathieunls/qw/connector"
+	"github.com/stretchr/testify/assert"
+)
+
+//recordLogger keeps the entries it is given
+type recordLogger struct {
+	entries []string
+}
+
+func (l *recordLogger) Log(ctx context.Context, level connector.Level, msg string, keyvals ...interface{}) {
+	l.entries = append(l.entries, fmt.Sprint(level, " ", msg, " ", keyvals))
+}
+
+func TestLogger(t *testing.T) {
+	s := []string{
+		"mock:mock@mock(127.0.0.1:3306)/mock",
+	}
+	cnx := new(CnxMock)
+	m, err := NewSQLQuery("bugs", s, cnx)
+
+	type Bug struct {
+		ID   int    `db:"id"`
+		Name string `db:"name"`
+	}
+	m.returnType = new(Bug)
+
+	assert := assert.New(t)
+	assert.Nil(err)
+
+	logger := new(recordLogger)
+	m.Logger(logger)
+
+	cnx.Mock.ExpectPrepare(regexp.QuoteMeta("SELECT  *  FROM bugs WHERE name = ?")).
+		ExpectQuery().
+		WithArgs("crash").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "crash").AddRow(2, "crash"))
+	cnx.Mock.ExpectPrepare(regexp.QuoteMeta("UPDATE bugs SET name = ? WHERE id = ?")).
+		ExpectExec().
+		WithArgs("secret", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	cnx.Mock.ExpectQuery(regexp.QuoteMeta("SELECT  count(1)  FROM bugs")).
+		WillReturnError(fmt.Errorf("gone away"))
+
+	_, err = m.WhereValue("name", "crash").FindAll()
+	assert.Nil(err)
+	_, err = m.RedactArgs(true).Update(&Bug{1, "secret"})
+	assert.Nil(err)
+	_, err = m.CountAll()
+	assert.NotNil(err)
+
+	assert.Len(logger.entries, 3)
+	assert.Regexp(`^0 qw: statement \[operation SELECT table bugs sql SELECT  \*  FROM bugs WHERE name = \? args \[crash\] duration \S+ rows 2\]$`, logger.entries[0])
+	assert.Regexp(`^0 qw: statement \[operation UPDATE .* args \[\[redacted\] \[redacted\]\] duration \S+ rows 1\]$`, logger.entries[1])
+	assert.Regexp(`^3 qw: statement failed \[operation SELECT .* rows 0 error gone away\]$`, logger.entries[2])
+
+	//Nothing is logged by default
+	assert.Equal(connector.NopLogger{}, m.Subquery("bugs").Logger(nil).logger)
+
+	assert.Nil(cnx.Mock.ExpectationsWereMet())
+}
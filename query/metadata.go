@@ -0,0 +1,390 @@
+package query
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+)
+
+//structMeta is the mapping of a struct type on columns.
+//It is computed once per type and NamingStrategy and shared by
+//every model
+type structMeta struct {
+	fields []field
+
+	//position in fields of each column
+	columns map[string]int
+
+	//the first tag error of the fields, the type can't be used with it
+	err error
+}
+
+//metaKey identifies a structMeta
+type metaKey struct {
+	t      reflect.Type
+	naming interface{}
+}
+
+//metaCache holds the structMeta already computed
+var metaCache sync.Map
+
+//resetMetaCache forgets the structMeta already computed
+func resetMetaCache() {
+	metaCache.Range(func(key, value interface{}) bool {
+		metaCache.Delete(key)
+		return true
+	})
+}
+
+//metaOf returns the structMeta of the struct type t
+func (model *SQLQuery) metaOf(t reflect.Type) *structMeta {
+	naming := namingKey(model.naming)
+	if naming == nil {
+		return newStructMeta(t, model.naming)
+	}
+
+	key := metaKey{t, naming}
+	if meta, ok := metaCache.Load(key); ok {
+		return meta.(*structMeta)
+	}
+
+	meta, _ := metaCache.LoadOrStore(key, newStructMeta(t, model.naming))
+	return meta.(*structMeta)
+}
+
+//newStructMeta computes the structMeta of t
+func newStructMeta(t reflect.Type, naming NamingStrategy) *structMeta {
+	meta := &structMeta{
+		fields:  fieldsOf(t, naming),
+		columns: make(map[string]int),
+	}
+	for index := 0; index < len(meta.fields); index++ {
+		meta.columns[meta.fields[index].column] = index
+		meta.fields[index].lazy = throughPointer(t, meta.fields[index].index)
+		if meta.err == nil {
+			meta.err = meta.fields[index].err
+		}
+	}
+	return meta
+}
+
+//plan returns, for each column of a resultset, the position of the
+//field it maps on or -1
+func (meta *structMeta) plan(columns []string) []int {
+	plan := make([]int, len(columns))
+	for index := 0; index < len(columns); index++ {
+		if position, ok := meta.columns[columns[index]]; ok {
+			plan[index] = position
+		} else {
+			plan[index] = -1
+		}
+	}
+	return plan
+}
+
+//destinations fills scanArgs with where each column of a row goes:
+//the field itself when database/sql can scan in it, a fieldScanner
+//converting into it otherwise, and a sink for the unmapped columns.
+//The fields behind struct pointers are left to fieldScanners, so the
+//pointers stay nil when all their columns are NULL
+func (meta *structMeta) destinations(reflected reflect.Value, plan []int, scanners []fieldScanner, scanArgs []interface{}) {
+	for index := 0; index < len(plan); index++ {
+		if plan[index] == -1 {
+			scanArgs[index] = new(sql.RawBytes)
+			continue
+		}
+
+		field := &meta.fields[plan[index]]
+		if field.lazy {
+			scanners[index] = fieldScanner{parent: reflected, field: field}
+			scanArgs[index] = &scanners[index]
+			continue
+		}
+
+		target := fieldOf(reflected, field.index)
+		if field.direct && field.converter == nil {
+			scanArgs[index] = target.Addr().Interface()
+			continue
+		}
+
+		scanners[index] = fieldScanner{target: target, set: field.set, converter: field.converter}
+		scanArgs[index] = &scanners[index]
+	}
+}
+
+//fieldScanner scans a column into a field.
+//Driver values of the field type are assigned as is, so time and
+//numeric columns round-trip exactly; other values are converted
+type fieldScanner struct {
+	target    reflect.Value
+	set       func(target reflect.Value, value []byte) error
+	converter *Converter
+
+	//the row and the field to reach when target is left to resolve
+	parent reflect.Value
+	field  *field
+}
+
+//Scan implements sql.Scanner
+func (scanner *fieldScanner) Scan(src interface{}) error {
+	if !scanner.target.IsValid() {
+		return scanner.scanLazy(src)
+	}
+
+	if scanner.converter != nil && scanner.converter.FromDB != nil {
+		return fromDB(scanner.target, src, scanner.converter)
+	}
+
+	switch value := src.(type) {
+	case nil:
+		scanner.target.Set(reflect.Zero(scanner.target.Type()))
+		return nil
+	case []byte:
+		return scanner.set(scanner.target, value)
+	case string:
+		return scanner.set(scanner.target, []byte(value))
+	}
+
+	source := reflect.ValueOf(src)
+	if source.Type().AssignableTo(scanner.target.Type()) {
+		scanner.target.Set(source)
+		return nil
+	}
+	if isNumeric(source.Kind()) && isNumeric(scanner.target.Kind()) {
+		return convertNumeric(source, scanner.target)
+	}
+
+	return scanner.set(scanner.target, []byte(fmt.Sprint(src)))
+}
+
+//scanLazy scans src into a field behind struct pointers, allocating
+//them unless src is NULL
+func (scanner *fieldScanner) scanLazy(src interface{}) error {
+	if src == nil {
+		return nil
+	}
+
+	field := scanner.field
+	target := fieldOf(scanner.parent, field.index)
+	if !field.direct || field.converter != nil {
+		resolved := fieldScanner{target: target, set: field.set, converter: field.converter}
+		return resolved.Scan(src)
+	}
+
+	if valueScanner, ok := target.Addr().Interface().(sql.Scanner); ok {
+		return valueScanner.Scan(src)
+	}
+
+	//A pointer field
+	value := reflect.New(target.Type().Elem())
+	resolved := fieldScanner{target: value.Elem(), set: setterOf(value.Elem().Type())}
+	if err := resolved.Scan(src); err != nil {
+		return err
+	}
+	target.Set(value)
+	return nil
+}
+
+//scannerType is the sql.Scanner interface type
+var scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+
+//valuerType is the driver.Valuer interface type
+var valuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+
+//timeType is the time.Time type
+var timeType = reflect.TypeOf(time.Time{})
+
+//timeLayouts are the textual datetime formats understood
+var timeLayouts = []string{
+	"2006-01-02 15:04:05.999999999",
+	time.RFC3339Nano,
+	"2006-01-02",
+}
+
+//isDirect reports whether database/sql can scan NULLs and values in
+//fields of type t by itself
+func isDirect(t reflect.Type) bool {
+	return t.Kind() == reflect.Ptr || reflect.PtrTo(t).Implements(scannerType)
+}
+
+//isNumeric reports whether kind is an integer or a float
+func isNumeric(kind reflect.Kind) bool {
+	return isInteger(kind) || kind == reflect.Float32 || kind == reflect.Float64
+}
+
+//isInteger reports whether kind is a signed or unsigned integer
+func isInteger(kind reflect.Kind) bool {
+	return kind >= reflect.Int && kind <= reflect.Uint64
+}
+
+//namingKey returns a comparable identity for naming, nil when there
+//is none and the metadata can't be cached
+func namingKey(naming NamingStrategy) interface{} {
+	value := reflect.ValueOf(naming)
+	//Funcs have none: closures of the same literal share their code
+	//pointer whatever they captured
+	if !value.IsValid() || value.Kind() == reflect.Func {
+		return nil
+	}
+	if !value.Type().Comparable() {
+		return nil
+	}
+	return naming
+}
+
+//setterOf returns the converter of raw column values for fields of type t
+func setterOf(t reflect.Type) func(target reflect.Value, value []byte) error {
+
+	if t == timeType {
+		return func(target reflect.Value, value []byte) error {
+			for index := 0; index < len(timeLayouts); index++ {
+				if parsed, err := time.Parse(timeLayouts[index], string(value)); err == nil {
+					target.Set(reflect.ValueOf(parsed))
+					return nil
+				}
+			}
+			return fmt.Errorf("qw: can't parse %q as a time", value)
+		}
+	}
+
+	//Swith on target kind for byte to type convertion.
+	//Window functions such as ROW_NUMBER or RANK yield
+	//BIGINT so every integer width is accepted
+	switch t.Kind() {
+	case reflect.Bool:
+		return func(target reflect.Value, value []byte) error {
+			boolValue, err := strconv.ParseBool(string(value))
+			if err != nil {
+				return err
+			}
+			target.SetBool(boolValue)
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return func(target reflect.Value, value []byte) error {
+			intValue, err := strconv.ParseInt(string(value), 10, 64)
+			if err != nil {
+				return err
+			}
+			if target.OverflowInt(intValue) {
+				return overflowError(value, target)
+			}
+			target.SetInt(intValue)
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return func(target reflect.Value, value []byte) error {
+			uintValue, err := strconv.ParseUint(string(value), 10, 64)
+			if err != nil {
+				return err
+			}
+			if target.OverflowUint(uintValue) {
+				return overflowError(value, target)
+			}
+			target.SetUint(uintValue)
+			return nil
+		}
+	case reflect.String:
+		return func(target reflect.Value, value []byte) error {
+			target.SetString(string(value))
+			return nil
+		}
+	case reflect.Float32, reflect.Float64:
+		return func(target reflect.Value, value []byte) error {
+			floatValue, err := strconv.ParseFloat(string(value), t.Bits())
+			if err != nil {
+				return err
+			}
+			target.SetFloat(floatValue)
+			return nil
+		}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return func(target reflect.Value, value []byte) error {
+				target.SetBytes(append([]byte{}, value...))
+				return nil
+			}
+		}
+	}
+
+	return func(target reflect.Value, value []byte) error {
+		return fmt.Errorf("qw: can't scan %q into a %v field", value, t)
+	}
+}
+
+//convertNumeric sets the number source into the numeric target,
+//failing rather than truncating or wrapping it
+func convertNumeric(source reflect.Value, target reflect.Value) error {
+	kind := source.Kind()
+	if kind == reflect.Float32 || kind == reflect.Float64 {
+		if !isInteger(target.Kind()) {
+			if target.OverflowFloat(source.Float()) {
+				return overflowError(source.Interface(), target)
+			}
+			target.SetFloat(source.Float())
+			return nil
+		}
+		if f := source.Float(); f != math.Trunc(f) {
+			return fmt.Errorf("qw: can't scan %v into a %v field without losing its fraction", f, target.Type())
+		}
+	}
+
+	switch {
+	case target.Kind() >= reflect.Int && target.Kind() <= reflect.Int64:
+		var intValue int64
+		switch {
+		case kind >= reflect.Int && kind <= reflect.Int64:
+			intValue = source.Int()
+		case isInteger(kind):
+			if source.Uint() > math.MaxInt64 {
+				return overflowError(source.Interface(), target)
+			}
+			intValue = int64(source.Uint())
+		default:
+			if source.Float() < math.MinInt64 || source.Float() >= math.MaxInt64 {
+				return overflowError(source.Interface(), target)
+			}
+			intValue = int64(source.Float())
+		}
+		if target.OverflowInt(intValue) {
+			return overflowError(source.Interface(), target)
+		}
+		target.SetInt(intValue)
+	case isInteger(target.Kind()):
+		var uintValue uint64
+		switch {
+		case kind >= reflect.Int && kind <= reflect.Int64:
+			if source.Int() < 0 {
+				return overflowError(source.Interface(), target)
+			}
+			uintValue = uint64(source.Int())
+		case isInteger(kind):
+			uintValue = source.Uint()
+		default:
+			if source.Float() < 0 || source.Float() >= math.MaxUint64 {
+				return overflowError(source.Interface(), target)
+			}
+			uintValue = uint64(source.Float())
+		}
+		if target.OverflowUint(uintValue) {
+			return overflowError(source.Interface(), target)
+		}
+		target.SetUint(uintValue)
+	default:
+		target.Set(source.Convert(target.Type()))
+	}
+	return nil
+}
+
+//overflowError is the error of a value out of the range of target
+func overflowError(value interface{}, target reflect.Value) error {
+	if b, ok := value.([]byte); ok {
+		value = string(b)
+	}
+	return fmt.Errorf("qw: %v overflows a %v field", value, target.Type())
+}
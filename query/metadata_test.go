@@ -0,0 +1,417 @@
+package query
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+type benchRow struct {
+	ID    int     `db:"id"`
+	Name  string  `db:"name"`
+	Score float64 `db:"score"`
+	Rank  int64   `db:"rank"`
+	Notes string
+}
+
+func TestMetaCache(t *testing.T) {
+	s := []string{
+		"mock:mock@mock(127.0.0.1:3306)/mock",
+	}
+	m1, err := NewSQLQuery("bench", s, new(CnxMock))
+	m2, _ := NewSQLQuery("other", s, new(CnxMock))
+
+	assert := assert.New(t)
+	assert.Nil(err)
+
+	rowType := reflect.TypeOf(benchRow{})
+	meta := m1.metaOf(rowType)
+	assert.True(meta == m2.metaOf(rowType), "should be shared across models")
+	assert.False(meta == m1.Naming(CamelCase{}).metaOf(rowType), "should depend on naming")
+
+	upper := NamingFunc(strings.ToUpper)
+	m2.Naming(upper)
+	assert.Equal(4, m2.metaOf(rowType).columns["NOTES"])
+
+	prefixer := func(prefix string) NamingFunc {
+		return func(name string) string { return prefix + name }
+	}
+	m2.Naming(prefixer("a_"))
+	assert.Equal(4, m2.metaOf(rowType).columns["a_Notes"])
+	m2.Naming(prefixer("b_"))
+	assert.Equal(4, m2.metaOf(rowType).columns["b_Notes"], "closures of a same literal should not share metadata")
+
+	assert.Equal([]int{1, -1, 0}, meta.plan([]string{"name", "unknown", "id"}))
+
+	m1.Naming(DefaultNaming).returnType = new(benchRow)
+	columns := []string{"id", "name", "score", "rank", "notes"}
+	scanned, err := scanRow(m1, columns, benchmarkRows(1)[0]...)
+	assert.Nil(err)
+	legacy := legacyReflectResult(m1, []sql.RawBytes{
+		[]byte("0"), []byte("name"), []byte("1.5"), []byte("42"), []byte("notes"),
+	}, columns)
+	assert.Equal(legacy, scanned)
+}
+
+func TestScanTypedDestinations(t *testing.T) {
+	s := []string{
+		"mock:mock@mock(127.0.0.1:3306)/mock",
+	}
+	cnx := new(CnxMock)
+	m, err := NewSQLQuery("invoices", s, cnx)
+
+	type Invoice struct {
+		ID       int64         `db:"id"`
+		Amount   string        `db:"amount"`
+		Rate     float32       `db:"rate"`
+		Paid     bool          `db:"paid"`
+		IssuedOn time.Time     `db:"issued_on"`
+		DueOn    time.Time     `db:"due_on"`
+		Count    int           `db:"count"`
+		Note     *string       `db:"note"`
+		Ref      sql.NullInt64 `db:"ref"`
+	}
+
+	assert := assert.New(t)
+	assert.Nil(err)
+
+	issued := time.Date(2017, 3, 4, 5, 6, 7, 123456789, time.UTC)
+	cnx.Mock.ExpectPrepare(regexp.QuoteMeta("SELECT  *  FROM invoices")).
+		ExpectQuery().
+		WillReturnRows(sqlmock.NewRows([]string{"id", "amount", "rate", "paid", "issued_on", "due_on", "count", "note", "ref", "extra"}).
+			AddRow(int64(1), []byte("12345678901234567890.12"), 0.5, true, issued, []byte("2017-04-04 00:00:00"), nil, "n", int64(7), "x").
+			AddRow(int64(2), int64(3), []byte("0.25"), []byte("1"), issued, nil, int64(4), nil, nil, nil))
+
+	m.returnType = new(Invoice)
+	invoices, err := m.FindAll()
+	assert.Nil(err)
+
+	note := "n"
+	assert.Equal([]interface{}{
+		Invoice{1, "12345678901234567890.12", 0.5, true, issued, time.Date(2017, 4, 4, 0, 0, 0, 0, time.UTC), 0, &note, sql.NullInt64{Int64: 7, Valid: true}},
+		Invoice{2, "3", 0.25, true, issued, time.Time{}, 4, nil, sql.NullInt64{}},
+	}, invoices)
+
+	assert.Nil(cnx.Mock.ExpectationsWereMet())
+}
+
+// benchmarkRows returns n raw rows matching benchRow
+func benchmarkRows(n int) [][]driver.Value {
+	rows := make([][]driver.Value, n)
+	for index := 0; index < n; index++ {
+		rows[index] = []driver.Value{
+			[]byte(strconv.Itoa(index)),
+			[]byte("name"),
+			[]byte("1.5"),
+			[]byte("42"),
+			[]byte("notes"),
+		}
+	}
+	return rows
+}
+
+//mockRows returns the rows of values under columns, read through
+//database/sql as they would be from a driver
+func mockRows(columns []string, values ...[]driver.Value) (*sql.Rows, error) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		return nil, err
+	}
+	result := sqlmock.NewRows(columns)
+	for index := 0; index < len(values); index++ {
+		result.AddRow(values[index]...)
+	}
+	mock.ExpectQuery("rows").WillReturnRows(result)
+	return db.Query("rows")
+}
+
+//scanRow scans values as the row of columns into a new model.returnType
+//the way selects do
+func scanRow(m *SQLQuery, columns []string, values ...driver.Value) (interface{}, error) {
+	rows, err := mockRows(columns, values)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	rows.Next()
+
+	rowType := reflect.TypeOf(m.returnType).Elem()
+	meta := m.metaOf(rowType)
+	plan := meta.plan(columns)
+	return scanPlanned(rows, rowType, meta, plan, make([]fieldScanner, len(plan)), make([]interface{}, len(plan)))
+}
+
+//scanPlanned scans the current row of rows into a new rowType
+//following plan, as executeSelectQuery does
+func scanPlanned(rows *sql.Rows, rowType reflect.Type, meta *structMeta, plan []int, scanners []fieldScanner, scanArgs []interface{}) (interface{}, error) {
+	reflected := reflect.New(rowType).Elem()
+	meta.destinations(reflected, plan, scanners, scanArgs)
+	if err := rows.Scan(scanArgs...); err != nil {
+		return nil, err
+	}
+	return reflected.Interface(), nil
+}
+
+// legacyReflectResult is reflectResult as it was before the metadata
+//cache: the column map and the fields are built again for every row
+func legacyReflectResult(model *SQLQuery, values []sql.RawBytes, columns []string) interface{} {
+
+	colMap := make(map[string]int)
+
+	//Index the columns by name for O(1) access
+	for index := 0; index < len(columns); index++ {
+		colMap[columns[index]] = index
+	}
+
+	//Reflect on model.returnType for reading/writing on fields
+	reflected := reflect.New(reflect.TypeOf(model.returnType).Elem()).Elem()
+	fields := fieldsOf(reflected.Type(), model.naming)
+
+	//For each mapped field in the model.result
+	for i := 0; i < len(fields); i++ {
+
+		//Check if that column is present in the resultset
+		if valKey, ok := colMap[fields[i].column]; ok {
+
+			//Get the value from the resultset
+			value := values[valKey]
+			target := reflected.FieldByIndex(fields[i].index)
+
+			//Swith on target kind for byte to type convertion
+			switch target.Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				intValue, _ := strconv.ParseInt(string(value), 10, 64)
+				target.SetInt(intValue)
+			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+				uintValue, _ := strconv.ParseUint(string(value), 10, 64)
+				target.SetUint(uintValue)
+			case reflect.String:
+				target.SetString(string(value))
+			case reflect.Float64:
+				floatValue, _ := strconv.ParseFloat(string(value), 64)
+				target.SetFloat(floatValue)
+			case reflect.Float32:
+				floatValue, _ := strconv.ParseFloat(string(value), 32)
+				target.SetFloat(floatValue)
+			}
+		}
+	}
+
+	return reflected.Interface()
+}
+
+// BenchmarkScan100k reads 100k rows into structs with the cached
+//metadata and the scan destinations, then as selects used to: through
+//sql.RawBytes, mapping each row with the fields built again
+func BenchmarkScan100k(b *testing.B) {
+	s := []string{
+		"mock:mock@mock(127.0.0.1:3306)/mock",
+	}
+	m, _ := NewSQLQuery("bench", s, new(CnxMock))
+	m.returnType = new(benchRow)
+
+	columns := []string{"id", "name", "score", "rank", "notes"}
+	values := benchmarkRows(100000)
+	rowType := reflect.TypeOf(benchRow{})
+
+	b.Run("cached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			rows, _ := mockRows(columns, values...)
+			b.StartTimer()
+
+			meta := m.metaOf(rowType)
+			plan := meta.plan(columns)
+			scanners := make([]fieldScanner, len(plan))
+			scanArgs := make([]interface{}, len(plan))
+			for rows.Next() {
+				scanPlanned(rows, rowType, meta, plan, scanners, scanArgs)
+			}
+			rows.Close()
+		}
+	})
+
+	b.Run("uncached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			rows, _ := mockRows(columns, values...)
+			b.StartTimer()
+
+			raw := make([]sql.RawBytes, len(columns))
+			scanArgs := make([]interface{}, len(raw))
+			for index := range raw {
+				scanArgs[index] = &raw[index]
+			}
+			for rows.Next() {
+				rows.Scan(scanArgs...)
+				legacyReflectResult(m, raw, columns)
+			}
+			rows.Close()
+		}
+	})
+}
+
+func TestScanConversionErrors(t *testing.T) {
+	type Row struct {
+		Int   int               `db:"int"`
+		Small int8              `db:"small"`
+		Count uint              `db:"count"`
+		Rate  float32           `db:"rate"`
+		Flag  bool              `db:"flag"`
+		Day   time.Time         `db:"day"`
+		Tags  map[string]string `db:"tags"`
+		Ref   sql.NullInt64     `db:"ref"`
+	}
+
+	cases := []struct {
+		column string
+		value  driver.Value
+		ok     bool
+	}{
+		{"int", []byte("abc"), false},
+		{"int", []byte("12.7"), false},
+		{"int", 12.7, false},
+		{"int", 12.0, true},
+		{"small", int64(300), false},
+		{"small", []byte("300"), false},
+		{"small", int64(-128), true},
+		{"count", int64(-1), false},
+		{"count", []byte("-1"), false},
+		{"count", int64(7), true},
+		{"rate", 1e300, false},
+		{"rate", []byte("1.5"), true},
+		{"flag", []byte("maybe"), false},
+		{"day", []byte("tomorrow"), false},
+		{"tags", []byte("a"), false},
+		{"ref", []byte("a"), false},
+		{"ref", []byte("7"), true},
+	}
+
+	assert := assert.New(t)
+	s := []string{
+		"mock:mock@mock(127.0.0.1:3306)/mock",
+	}
+	m, err := NewSQLQuery("rows", s, new(CnxMock))
+	assert.Nil(err)
+	m.returnType = new(Row)
+
+	for index := 0; index < len(cases); index++ {
+		_, err := scanRow(m, []string{cases[index].column}, cases[index].value)
+		assert.Equal(cases[index].ok, err == nil, "%s <- %#v: %v", cases[index].column, cases[index].value, err)
+	}
+}
+
+type Audit struct {
+	CreatedBy  string `db:"created_by"`
+	ModifiedBy string `db:"modified_by"`
+}
+
+type Address struct {
+	Street string `db:"street"`
+	City   string `db:"city"`
+}
+
+type Customer struct {
+	ID int `db:"id"`
+	Audit
+	Name    string   `db:"name"`
+	Home    Address  `db:"home_,prefix"`
+	Billing *Address `db:"bill_,prefix"`
+	Created time.Time
+}
+
+func TestNestedStructs(t *testing.T) {
+	s := []string{
+		"mock:mock@mock(127.0.0.1:3306)/mock",
+	}
+	cnx := new(CnxMock)
+	m, err := NewSQLQuery("customers", s, cnx)
+
+	assert := assert.New(t)
+	assert.Nil(err)
+
+	columns := []string{}
+	for _, field := range m.metaOf(reflect.TypeOf(Customer{})).fields {
+		columns = append(columns, field.column)
+	}
+	assert.Equal([]string{"id", "created_by", "modified_by", "name", "home_street", "home_city", "bill_street", "bill_city", "created"}, columns)
+
+	created := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	cnx.Mock.ExpectPrepare(regexp.QuoteMeta("INSERT INTO customers (created_by, modified_by, name, home_street, home_city, bill_street, bill_city, created)  VALUES (?, ?, ?, ?, ?, ?, ?, ?)")).
+		ExpectExec().
+		WithArgs("bob", "", "acme", "main st", "paris", nil, nil, created).
+		WillReturnResult(sqlmock.NewResult(3, 1))
+	finder, _ := NewSQLQuery("customers", s, cnx)
+	cnx.Mock.ExpectPrepare(regexp.QuoteMeta("SELECT  *  FROM customers")).
+		ExpectQuery().
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_by", "home_city", "bill_city"}).
+			AddRow(3, "bob", "paris", "lyon").
+			AddRow(4, "ann", "nice", nil))
+
+	c := &Customer{Audit: Audit{CreatedBy: "bob"}, Name: "acme", Home: Address{"main st", "paris"}, Created: created}
+	_, err = m.Insert(c)
+	assert.Nil(err)
+	assert.Equal(3, c.ID)
+	assert.Nil(c.Billing)
+
+	finder.returnType = new(Customer)
+	customers, err := finder.FindAll()
+	assert.Nil(err)
+	assert.Equal(Customer{ID: 3, Audit: Audit{CreatedBy: "bob"}, Home: Address{City: "paris"}, Billing: &Address{City: "lyon"}}, customers[0])
+	assert.Equal(Customer{ID: 4, Audit: Audit{CreatedBy: "ann"}, Home: Address{City: "nice"}, Billing: nil}, customers[1])
+
+	type Contact struct {
+		Phone *string        `db:"phone"`
+		Email sql.NullString `db:"email"`
+	}
+	type Lead struct {
+		ID      int      `db:"id"`
+		Contact *Contact `db:"contact_,prefix"`
+	}
+
+	finder.returnType = new(Lead)
+	lead, err := scanRow(finder, []string{"id", "contact_phone", "contact_email"}, int64(1), nil, nil)
+	assert.Nil(err)
+	assert.Equal(Lead{ID: 1}, lead)
+
+	lead, err = scanRow(finder, []string{"id", "contact_phone", "contact_email"}, int64(2), []byte("555"), nil)
+	assert.Nil(err)
+	assert.Equal("555", *lead.(Lead).Contact.Phone)
+	assert.False(lead.(Lead).Contact.Email.Valid)
+
+	lead, err = scanRow(finder, []string{"id", "contact_phone", "contact_email"}, int64(3), nil, "a@b.c")
+	assert.Nil(err)
+	assert.Nil(lead.(Lead).Contact.Phone)
+	assert.Equal(sql.NullString{String: "a@b.c", Valid: true}, lead.(Lead).Contact.Email)
+
+	assert.Nil(cnx.Mock.ExpectationsWereMet())
+}
+
+type Node struct {
+	ID     int   `db:"id"`
+	Parent *Node `db:"parent_,prefix"`
+}
+
+func TestRecursivePrefix(t *testing.T) {
+	s := []string{
+		"mock:mock@mock(127.0.0.1:3306)/mock",
+	}
+	m, err := NewSQLQuery("nodes", s, new(CnxMock))
+
+	assert := assert.New(t)
+	assert.Nil(err)
+
+	meta := m.metaOf(reflect.TypeOf(Node{}))
+	assert.EqualError(meta.err, "qw: query.Node can't be mapped within itself on field Parent")
+
+	_, err = m.Insert(&Node{ID: 1})
+	assert.Equal(meta.err, err)
+}
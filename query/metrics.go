@@ -0,0 +1,248 @@
+package query
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Collector receives the outcome of every statement of the models it
+//is given to
+type Collector interface {
+	Observe(table string, operation string, rows int64, duration time.Duration, err error)
+}
+
+//PoolCollector is implemented by the collectors that also watch the
+//connection pool of the models
+type PoolCollector interface {
+	CollectPool(name string, stats func() sql.DBStats)
+}
+
+//Collector sets the collector of the model statements
+func (model *SQLQuery) Collector(collector Collector) *SQLQuery {
+	model.collector = collector
+	return model
+}
+
+//CollectPool registers the model connection pool to pools under name.
+//Models sharing a connection may share its name, a pool registered
+//again under a name replaces the former
+//	users.Collector(metrics).CollectPool(metrics, "main")
+func (model *SQLQuery) CollectPool(pools PoolCollector, name string) *SQLQuery {
+	if model.db != nil {
+		pools.CollectPool(name, model.Stats)
+	}
+	return model
+}
+
+//Stats returns the statistics of the model connection pool
+func (model *SQLQuery) Stats() sql.DBStats {
+	return model.db.Stats()
+}
+
+//DefaultBuckets are the upper bounds, in seconds, of the latency
+//histograms of Metrics
+var DefaultBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+//Metrics is an in-memory Collector and PoolCollector. It serves its
+//metrics in the Prometheus text format
+//http.Handle("/metrics", metrics)
+type Metrics struct {
+	mutex   sync.Mutex
+	buckets []float64
+	series  map[seriesKey]*series
+	pools   map[string]func() sql.DBStats
+}
+
+//seriesKey identifies the series of a table and an operation
+type seriesKey struct {
+	table     string
+	operation string
+}
+
+//series is what is known of a table and an operation
+type series struct {
+	queries int64
+	errors  int64
+	rows    int64
+
+	//counts[i] counts the durations lower or equal to buckets[i]
+	counts []int64
+	sum    float64
+}
+
+//NewMetrics returns Metrics with latency histograms bounded by buckets,
+//DefaultBuckets if none
+func NewMetrics(buckets ...float64) *Metrics {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64{}, buckets...)
+	sort.Float64s(buckets)
+
+	return &Metrics{
+		buckets: buckets,
+		series:  make(map[seriesKey]*series),
+		pools:   make(map[string]func() sql.DBStats),
+	}
+}
+
+//Observe counts a statement
+func (metrics *Metrics) Observe(table string, operation string, rows int64, duration time.Duration, err error) {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+
+	key := seriesKey{table, operation}
+	s, ok := metrics.series[key]
+	if !ok {
+		s = &series{counts: make([]int64, len(metrics.buckets))}
+		metrics.series[key] = s
+	}
+
+	s.queries++
+	if err != nil {
+		s.errors++
+	}
+	s.rows += rows
+
+	seconds := duration.Seconds()
+	s.sum += seconds
+	for index := 0; index < len(metrics.buckets); index++ {
+		if seconds <= metrics.buckets[index] {
+			s.counts[index]++
+		}
+	}
+}
+
+//CollectPool watches the connection pool stats under name
+func (metrics *Metrics) CollectPool(name string, stats func() sql.DBStats) {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+	metrics.pools[name] = stats
+}
+
+//ServeHTTP writes the metrics in the Prometheus text format
+func (metrics *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	metrics.WriteText(w)
+}
+
+//WriteText writes the metrics to w in the Prometheus text format
+func (metrics *Metrics) WriteText(w io.Writer) error {
+	metrics.mutex.Lock()
+	defer metrics.mutex.Unlock()
+
+	out := bufio.NewWriter(w)
+
+	keys := make([]seriesKey, 0, len(metrics.series))
+	for key := range metrics.series {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].table != keys[j].table {
+			return keys[i].table < keys[j].table
+		}
+		return keys[i].operation < keys[j].operation
+	})
+
+	counters := []struct {
+		name  string
+		help  string
+		value func(*series) int64
+	}{
+		{"qw_queries_total", "Statements run.", func(s *series) int64 { return s.queries }},
+		{"qw_errors_total", "Statements that failed.", func(s *series) int64 { return s.errors }},
+		{"qw_rows_total", "Rows returned by the selects or affected by the writes.", func(s *series) int64 { return s.rows }},
+	}
+	for index := 0; index < len(counters); index++ {
+		counter := counters[index]
+		writeHeader(out, counter.name, counter.help, "counter")
+		for k := 0; k < len(keys); k++ {
+			fmt.Fprintf(out, "%s{%s} %d\n", counter.name, keys[k].labels(), counter.value(metrics.series[keys[k]]))
+		}
+	}
+
+	writeHeader(out, "qw_query_duration_seconds", "Statement latency.", "histogram")
+	for k := 0; k < len(keys); k++ {
+		key := keys[k]
+		s := metrics.series[key]
+		for index := 0; index < len(metrics.buckets); index++ {
+			fmt.Fprintf(out, "qw_query_duration_seconds_bucket{%s,le=\"%s\"} %d\n",
+				key.labels(), formatFloat(metrics.buckets[index]), s.counts[index])
+		}
+		fmt.Fprintf(out, "qw_query_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", key.labels(), s.queries)
+		fmt.Fprintf(out, "qw_query_duration_seconds_sum{%s} %s\n", key.labels(), formatFloat(s.sum))
+		fmt.Fprintf(out, "qw_query_duration_seconds_count{%s} %d\n", key.labels(), s.queries)
+	}
+
+	metrics.writePools(out)
+	return out.Flush()
+}
+
+//writePools writes the connection pool stats
+func (metrics *Metrics) writePools(out io.Writer) {
+	names := make([]string, 0, len(metrics.pools))
+	for name := range metrics.pools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	stats := make([]sql.DBStats, len(names))
+	for index := 0; index < len(names); index++ {
+		stats[index] = metrics.pools[names[index]]()
+	}
+
+	pools := []struct {
+		name  string
+		help  string
+		kind  string
+		value func(sql.DBStats) string
+	}{
+		{"qw_pool_max_open_connections", "Maximum number of open connections.", "gauge",
+			func(s sql.DBStats) string { return strconv.Itoa(s.MaxOpenConnections) }},
+		{"qw_pool_open_connections", "Established connections.", "gauge",
+			func(s sql.DBStats) string { return strconv.Itoa(s.OpenConnections) }},
+		{"qw_pool_in_use_connections", "Connections in use.", "gauge",
+			func(s sql.DBStats) string { return strconv.Itoa(s.InUse) }},
+		{"qw_pool_idle_connections", "Idle connections.", "gauge",
+			func(s sql.DBStats) string { return strconv.Itoa(s.Idle) }},
+		{"qw_pool_wait_total", "Connections waited for.", "counter",
+			func(s sql.DBStats) string { return strconv.FormatInt(s.WaitCount, 10) }},
+		{"qw_pool_wait_seconds_total", "Time spent waiting for a connection.", "counter",
+			func(s sql.DBStats) string { return formatFloat(s.WaitDuration.Seconds()) }},
+	}
+	for p := 0; p < len(pools) && len(names) > 0; p++ {
+		pool := pools[p]
+		writeHeader(out, pool.name, pool.help, pool.kind)
+		for index := 0; index < len(names); index++ {
+			fmt.Fprintf(out, "%s{pool=\"%s\"} %s\n", pool.name, escapeLabel(names[index]), pool.value(stats[index]))
+		}
+	}
+}
+
+//labels renders the labels of key
+func (key seriesKey) labels() string {
+	return "table=\"" + escapeLabel(key.table) + "\",operation=\"" + escapeLabel(key.operation) + "\""
+}
+
+//writeHeader writes the HELP and TYPE lines of a metric
+func writeHeader(out io.Writer, name string, help string, kind string) {
+	fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+//escapeLabel escapes a label value as the text format wants
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+//formatFloat formats a sample value
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
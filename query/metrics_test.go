@@ -0,0 +1,104 @@
+package query
+
+import (
+	"bytes"
+	"errors"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	metrics := NewMetrics(0.5, 0.1)
+
+	metrics.Observe("bugs", "SELECT", 3, 50*time.Millisecond, nil)
+	metrics.Observe("bugs", "SELECT", 0, 200*time.Millisecond, errors.New("timeout"))
+	metrics.Observe("bugs", "INSERT", 1, time.Second, nil)
+
+	var out bytes.Buffer
+	assert := assert.New(t)
+	assert.Nil(metrics.WriteText(&out))
+
+	assert.Equal(`# HELP qw_queries_total Statements run.
+# TYPE qw_queries_total counter
+qw_queries_total{table="bugs",operation="INSERT"} 1
+qw_queries_total{table="bugs",operation="SELECT"} 2
+# HELP qw_errors_total Statements that failed.
+# TYPE qw_errors_total counter
+qw_errors_total{table="bugs",operation="INSERT"} 0
+qw_errors_total{table="bugs",operation="SELECT"} 1
+# HELP qw_rows_total Rows returned by the selects or affected by the writes.
+# TYPE qw_rows_total counter
+qw_rows_total{table="bugs",operation="INSERT"} 1
+qw_rows_total{table="bugs",operation="SELECT"} 3
+# HELP qw_query_duration_seconds Statement latency.
+# TYPE qw_query_duration_seconds histogram
+qw_query_duration_seconds_bucket{table="bugs",operation="INSERT",le="0.1"} 0
+qw_query_duration_seconds_bucket{table="bugs",operation="INSERT",le="0.5"} 0
+qw_query_duration_seconds_bucket{table="bugs",operation="INSERT",le="+Inf"} 1
+qw_query_duration_seconds_sum{table="bugs",operation="INSERT"} 1
+qw_query_duration_seconds_count{table="bugs",operation="INSERT"} 1
+qw_query_duration_seconds_bucket{table="bugs",operation="SELECT",le="0.1"} 1
+qw_query_duration_seconds_bucket{table="bugs",operation="SELECT",le="0.5"} 2
+qw_query_duration_seconds_bucket{table="bugs",operation="SELECT",le="+Inf"} 2
+qw_query_duration_seconds_sum{table="bugs",operation="SELECT"} 0.25
+qw_query_duration_seconds_count{table="bugs",operation="SELECT"} 2
+`, out.String())
+}
+
+func TestMetricsCollector(t *testing.T) {
+	s := []string{
+		"mock:mock@mock(127.0.0.1:3306)/mock",
+	}
+	cnx := new(CnxMock)
+	m, err := NewSQLQuery("bugs", s, cnx)
+
+	type Bug struct {
+		ID   int    `db:"id"`
+		Name string `db:"name"`
+	}
+	m.returnType = new(Bug)
+
+	assert := assert.New(t)
+	assert.Nil(err)
+
+	metrics := NewMetrics()
+	m.Collector(metrics).CollectPool(metrics, "main")
+
+	//Models of a same table watch their own pools
+	replica, err := NewSQLQuery("bugs", s, new(CnxMock))
+	assert.Nil(err)
+	replica.CollectPool(metrics, "replica")
+
+	cnx.Mock.ExpectPrepare(regexp.QuoteMeta("SELECT  *  FROM bugs")).
+		ExpectQuery().
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "crash").AddRow(2, "hang"))
+	cnx.Mock.ExpectPrepare(regexp.QuoteMeta("DELETE FROM bugs WHERE id = ?")).
+		ExpectExec().
+		WillReturnError(errors.New("locked"))
+
+	_, err = m.FindAll()
+	assert.Nil(err)
+	_, err = m.Delete(&Bug{1, "crash"})
+	assert.NotNil(err)
+
+	recorder := httptest.NewRecorder()
+	metrics.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body := recorder.Body.String()
+
+	assert.True(strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/plain; version=0.0.4"))
+	assert.Contains(body, `qw_rows_total{table="bugs",operation="SELECT"} 2`)
+	assert.Contains(body, `qw_errors_total{table="bugs",operation="DELETE"} 1`)
+	assert.Contains(body, `qw_query_duration_seconds_count{table="bugs",operation="SELECT"} 1`)
+	assert.Contains(body, "# TYPE qw_pool_open_connections gauge\n")
+	assert.Regexp(`qw_pool_open_connections\{pool="main"\} \d+`, body)
+	assert.Regexp(`qw_pool_open_connections\{pool="replica"\} \d+`, body)
+	assert.NotContains(body, `pool="bugs"`)
+
+	assert.Nil(cnx.Mock.ExpectationsWereMet())
+}
@@ -0,0 +1,85 @@
+package query
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/mathieunls/qw/connector"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddlewares(t *testing.T) {
+	s := []string{
+		"mock:mock@mock(127.0.0.1:3306)/mock",
+	}
+
+	seen := []string{}
+	record := func(next connector.Exec) connector.Exec {
+		return func(ctx context.Context, statement *connector.Statement) error {
+			seen = append(seen, statement.Operation+" "+statement.Table)
+			return next(ctx, statement)
+		}
+	}
+	errReadOnly := errors.New("read only")
+	tenant := func(next connector.Exec) connector.Exec {
+		return func(ctx context.Context, statement *connector.Statement) error {
+			if statement.Operation == "DELETE" {
+				return errReadOnly
+			}
+			if statement.Operation == "SELECT" {
+				statement.SQL += " AND tenant = ?"
+				statement.Args = append(statement.Args, 42)
+			}
+			return next(ctx, statement)
+		}
+	}
+
+	cnx := new(CnxMock)
+	m, err := NewSQLQuery("bugs", s, connector.Use(connector.Use(cnx, record), tenant))
+
+	type Bug struct {
+		ID   int    `db:"id"`
+		Name string `db:"name"`
+	}
+	m.returnType = new(Bug)
+
+	assert := assert.New(t)
+	assert.Nil(err)
+	assert.Equal(MySQL, m.dialect)
+
+	cnx.Mock.ExpectPrepare(regexp.QuoteMeta("SELECT  *  FROM bugs WHERE name = ? AND tenant = ?")).
+		ExpectQuery().
+		WithArgs("crash", 42).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "crash"))
+	cnx.Mock.ExpectQuery(regexp.QuoteMeta("SELECT  count(1)  FROM bugs WHERE name = ? AND tenant = ?")).
+		WithArgs("crash", 42).
+		WillReturnRows(sqlmock.NewRows([]string{"c"}).AddRow(1))
+	cnx.Mock.ExpectPrepare(regexp.QuoteMeta("UPDATE bugs SET name = ? WHERE id = ?")).
+		ExpectExec().
+		WithArgs("crash", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	bugs, err := m.WhereValue("name", "crash").FindAll()
+	assert.Nil(err)
+	assert.Equal([]interface{}{Bug{1, "crash"}}, bugs)
+	assert.Equal("SELECT  *  FROM bugs WHERE name = ? AND tenant = ?", m.LastQuery())
+
+	count, err := m.WhereValue("name", "crash").CountAll()
+	assert.Nil(err)
+	assert.Equal(1, count)
+
+	_, err = m.Update(&Bug{1, "crash"})
+	assert.Nil(err)
+
+	_, err = m.Delete(&Bug{1, "crash"})
+	assert.Equal(errReadOnly, err)
+
+	//Subqueries share the middlewares of their model
+	assert.Len(m.Subquery("bugs").middlewares, 2)
+
+	assert.Equal([]string{"SELECT bugs", "SELECT bugs", "UPDATE bugs", "DELETE bugs"}, seen)
+	assert.Nil(cnx.Mock.ExpectationsWereMet())
+}
@@ -0,0 +1,136 @@
+package query
+
+import (
+	"reflect"
+	"unicode"
+)
+
+//NamingStrategy turns Go identifiers into database names.
+//It names the columns of the fields without `db` tag and the table
+//of a struct
+type NamingStrategy interface {
+
+	//Returns the column name of a struct field
+	ColumnName(field string) string
+
+	//Returns the table name of a struct
+	TableName(structName string) string
+}
+
+//SnakeCase names UserID user_id and BugReport bug_report
+type SnakeCase struct{}
+
+//ColumnName returns field in snake_case
+func (SnakeCase) ColumnName(field string) string {
+	return toSnakeCase(field)
+}
+
+//TableName returns structName in snake_case
+func (SnakeCase) TableName(structName string) string {
+	return toSnakeCase(structName)
+}
+
+//CamelCase names UserID userID and BugReport bugReport
+type CamelCase struct{}
+
+//ColumnName returns field in camelCase
+func (CamelCase) ColumnName(field string) string {
+	return toCamelCase(field)
+}
+
+//TableName returns structName in camelCase
+func (CamelCase) TableName(structName string) string {
+	return toCamelCase(structName)
+}
+
+//NamingFunc uses a custom function for both columns and tables
+//	model.Naming(query.NamingFunc(strings.ToUpper))
+type NamingFunc func(string) string
+
+//ColumnName applies the function on field
+func (f NamingFunc) ColumnName(field string) string {
+	return f(field)
+}
+
+//TableName applies the function on structName
+func (f NamingFunc) TableName(structName string) string {
+	return f(structName)
+}
+
+//DefaultNaming is the NamingStrategy of the new models
+var DefaultNaming NamingStrategy = SnakeCase{}
+
+//Naming sets the NamingStrategy used for untagged fields and
+//table names
+func (model *SQLQuery) Naming(naming NamingStrategy) *SQLQuery {
+	model.naming = naming
+	return model
+}
+
+//Table derives the model table from the struct proto using the
+//NamingStrategy, unless proto has a TableName() string method
+//	model.Table(new(BugReport)) // bug_report
+func (model *SQLQuery) Table(proto interface{}) *SQLQuery {
+	model.tableName = model.tableOf(proto)
+	return model
+}
+
+//tableOf returns the table the struct data maps on
+func (model *SQLQuery) tableOf(data interface{}) string {
+	if tabler, ok := data.(interface {
+		TableName() string
+	}); ok {
+		return tabler.TableName()
+	}
+
+	t := reflect.TypeOf(data)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return model.naming.TableName(t.Name())
+}
+
+//table returns the model table, derived from the return type if no
+//table was given
+func (model *SQLQuery) table(data interface{}) string {
+	if model.tableName == "" && data != nil {
+		return model.tableOf(data)
+	}
+	return model.tableName
+}
+
+//toSnakeCase splits name on case changes, keeping acronyms whole:
+//HTTPServer gives http_server
+func toSnakeCase(name string) string {
+	runes := []rune(name)
+	snake := []rune{}
+
+	for i := 0; i < len(runes); i++ {
+		if i > 0 && unicode.IsUpper(runes[i]) {
+			previous := runes[i-1]
+			nextIsLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(previous) || unicode.IsDigit(previous) ||
+				(unicode.IsUpper(previous) && nextIsLower) {
+				snake = append(snake, '_')
+			}
+		}
+		snake = append(snake, unicode.ToLower(runes[i]))
+	}
+
+	return string(snake)
+}
+
+//toCamelCase lowers the leading capitals of name, keeping the first
+//letter of the following word: HTTPServer gives httpServer
+func toCamelCase(name string) string {
+	runes := []rune(name)
+
+	for i := 0; i < len(runes) && unicode.IsUpper(runes[i]); i++ {
+		if i > 0 && i+1 < len(runes) && unicode.IsLower(runes[i+1]) {
+			break
+		}
+		runes[i] = unicode.ToLower(runes[i])
+	}
+
+	return string(runes)
+}
@@ -0,0 +1,83 @@
+package query
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+type BugReport struct {
+	ID         int `db:"id,pk,auto"`
+	Title      string
+	HTTPStatus int
+	ReportedBy string `db:",omitempty"`
+}
+
+type Legacy struct {
+	ID int `db:"id"`
+}
+
+func (Legacy) TableName() string {
+	return "tbl_legacy"
+}
+
+func TestNamingStrategies(t *testing.T) {
+	assert := assert.New(t)
+
+	names := map[string][2]string{
+		"ID":         {"id", "id"},
+		"UserID":     {"user_id", "userID"},
+		"HTTPServer": {"http_server", "httpServer"},
+		"BugReport":  {"bug_report", "bugReport"},
+		"Sha256Sum":  {"sha256_sum", "sha256Sum"},
+		"name":       {"name", "name"},
+	}
+
+	for name, expected := range names {
+		assert.Equal(expected[0], SnakeCase{}.ColumnName(name))
+		assert.Equal(expected[1], CamelCase{}.ColumnName(name))
+	}
+	assert.Equal("BUGREPORT", NamingFunc(strings.ToUpper).TableName("BugReport"))
+}
+
+func TestUntaggedFields(t *testing.T) {
+	s := []string{
+		"mock:mock@mock(127.0.0.1:3306)/mock",
+	}
+	cnx := new(CnxMock)
+	m, err := NewSQLQuery("", s, cnx)
+
+	assert := assert.New(t)
+	assert.Nil(err)
+
+	cnx.Mock.ExpectPrepare(regexp.QuoteMeta("INSERT INTO bug_report (title, http_status)  VALUES (?, ?)")).
+		ExpectExec().
+		WithArgs("crash", 500).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	cnx.Mock.ExpectPrepare(regexp.QuoteMeta("DELETE FROM tbl_legacy WHERE id = ?")).
+		ExpectExec().
+		WithArgs(2).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	_, err = m.Insert(&BugReport{Title: "crash", HTTPStatus: 500})
+	assert.Nil(err)
+	_, err = m.Delete(&Legacy{2})
+	assert.Nil(err)
+
+	m.returnType = new(BugReport)
+	assert.Equal("SELECT  *  FROM bug_report", m.composeSelectString())
+
+	m.Naming(CamelCase{})
+	assert.Equal("SELECT  *  FROM bugReport", m.composeSelectString())
+	reflectedStruct, err := scanRow(m, []string{"id", "title", "httpStatus", "reportedBy"},
+		[]byte("1"), []byte("crash"), []byte("404"), []byte("ann"))
+	assert.Nil(err)
+	assert.Equal(BugReport{1, "crash", 404, "ann"}, reflectedStruct.(BugReport))
+
+	assert.Equal("SELECT  *  FROM tbl_legacy", m.Table(new(Legacy)).composeSelectString())
+
+	assert.Nil(cnx.Mock.ExpectationsWereMet())
+}
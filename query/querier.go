@@ -1,9 +1,17 @@
 package query
 
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/mathieunls/qw/connector"
+)
+
 //Querier represents whats doable accross all adapators
 //Any new adaptor must implement this
 type Querier interface {
-	Key(key string) *Querier
+	Key(keys ...string) *Querier
 	CreatedField(createdField string) *Querier
 	ModifiedField(modifiedField string) *Querier
 	DeletedField(deletedField string) *Querier
@@ -11,8 +19,32 @@ type Querier interface {
 	Modified(modified bool) *Querier
 	SoftDeletes(softDeletes bool) *Querier
 	DateFormat(dateFormat string) *Querier
+	VersionField(versionField string) *Querier
+	Dialect(dialect string) *Querier
+	Naming(naming NamingStrategy) *Querier
+	Table(proto interface{}) *Querier
+	Begin() error
+	Commit() error
+	Rollback() error
+	WithContext(ctx context.Context) *Querier
+	Logger(logger connector.Logger) *Querier
+	RedactArgs(redact bool) *Querier
+	SlowQueries(threshold time.Duration, report func(SlowQuery), explain bool) *Querier
+	Tracer(tracer Tracer) *Querier
+	Collector(collector Collector) *Querier
+	CollectPool(pools PoolCollector, name string) *Querier
+	Stats() sql.DBStats
+	Explain() (Plan, error)
+	ExplainAnalyze() (Plan, error)
 	Debug()
 	Join(table string, condition string, joinType string) *Querier
+	With(name string, sub *SQLQuery) *Querier
+	WithRecursive(name string, anchor *SQLQuery, recursive *SQLQuery) *Querier
+	From(table string) *Querier
+	LockForUpdate() *Querier
+	SharedLock() *Querier
+	SkipLocked() *Querier
+	NoWait() *Querier
 	Union(selectString string) *Querier
 	OrWhere(field string, value string) *Querier
 	WhereIn(field string, values []string) *Querier
@@ -31,27 +63,57 @@ type Querier interface {
 	Offset(offset int) *Querier
 	LastQuery() string
 	Where(field string, value string) *Querier
+	WhereValue(field string, value interface{}) *Querier
+	WhereJSON(path string, op string, value interface{}) *Querier
 	Select(selectString string) *Querier
-	SelectMax(selectString string) *Querier
-	SelectMin(selectString string) *Querier
-	SelectAvg(selectString string) *Querier
-	SelectSum(selectString string) *Querier
-	Find(id string) (interface{}, error)
+	SelectMax(selectString string, alias ...string) *Querier
+	SelectMin(selectString string, alias ...string) *Querier
+	SelectAvg(selectString string, alias ...string) *Querier
+	SelectSum(selectString string, alias ...string) *Querier
+	SelectWindow(fn string, partitionBy string, orderBy string, alias string) *Querier
+	SelectRowNumber(partitionBy string, orderBy string, alias string) *Querier
+	SelectRank(partitionBy string, orderBy string, alias string) *Querier
+	SelectDenseRank(partitionBy string, orderBy string, alias string) *Querier
+	SelectLag(field string, offset int, partitionBy string, orderBy string, alias string) *Querier
+	SelectLead(field string, offset int, partitionBy string, orderBy string, alias string) *Querier
+	SelectRunningSum(field string, partitionBy string, orderBy string, alias string) *Querier
+	Find(key ...interface{}) (interface{}, error)
+	ReturnType(proto interface{}) *Querier
+	Into(dest interface{}) error
 	FindAll() ([]interface{}, error)
+	AsMap() ([]map[string]interface{}, error)
+	AsRows() ([]string, [][]interface{}, error)
 	FindAllBy(fields map[string]string) ([]interface{}, error)
 	FindBy(field string, value string) (interface{}, error)
 	CountAll() (int, error)
+	Sum(field string) (sql.NullFloat64, error)
+	Avg(field string) (sql.NullFloat64, error)
+	Min(field string) (interface{}, error)
+	Max(field string) (interface{}, error)
+	Value(field string) (interface{}, error)
+	Pluck(field string) ([]interface{}, error)
+	Exists() (bool, error)
 	CountBy(field string, value string) (int, error)
 	IsUnique(field string, value string) (bool, error)
 	Insert(data interface{}) (bool, error)
 	Delete(data interface{}) (bool, error)
 	Update(data interface{}) (bool, error)
-	BeforeInsert(triggers []func([]interface{})) *Querier
-	AfterInsert(triggers []func([]interface{})) *Querier
-	BeforeUpdate(triggers []func([]interface{})) *Querier
-	AfterUpdate(triggers []func([]interface{})) *Querier
-	BeforeFind(triggers []func([]interface{})) *Querier
-	AfterFind(triggers []func([]interface{})) *Querier
-	BeforeDelete(triggers []func([]interface{})) *Querier
-	AfterDelete(triggers []func([]interface{})) *Querier
+	BeforeInsert(triggers []Hook) *Querier
+	AfterInsert(triggers []Hook) *Querier
+	BeforeUpdate(triggers []Hook) *Querier
+	AfterUpdate(triggers []Hook) *Querier
+	BeforeFind(triggers []Hook) *Querier
+	AfterFind(triggers []Hook) *Querier
+	BeforeDelete(triggers []Hook) *Querier
+	AfterDelete(triggers []Hook) *Querier
+	On(event Event, hook Hook, options ...HookOption) (unregister func())
+	RemoveHook(event Event, name string) bool
+	OnBeforeInsert(hook Hook, options ...HookOption) (unregister func())
+	OnBeforeUpdate(hook Hook, options ...HookOption) (unregister func())
+	OnBeforeFind(hook Hook, options ...HookOption) (unregister func())
+	OnBeforeDelete(hook Hook, options ...HookOption) (unregister func())
+	OnAfterInsert(hook Hook, options ...HookOption) (unregister func())
+	OnAfterUpdate(hook Hook, options ...HookOption) (unregister func())
+	OnAfterFind(hook Hook, options ...HookOption) (unregister func())
+	OnAfterDelete(hook Hook, options ...HookOption) (unregister func())
 }
@@ -1,6 +1,10 @@
 package query
 
-import "database/sql"
+import (
+	"context"
+	"database/sql"
+	"time"
+)
 
 type query struct {
 
@@ -39,28 +43,27 @@ type query struct {
 	/**
 	* Observer Slices
 	*
-	* Each slice can contain callback functions
+	* Each slice can contain hooks
 	* which will be called during each event.
 	*
 	* <code>
 	*  model.BeforeInsert(
-	*    []func{
-	*        func() string{ return "Hello" },
-	*        func() string{ return " " },
-	*        func() string{ return "World" }
+	*    []Hook{
+	*        func(ctx context.Context, event *HookEvent) error { return nil },
+	*        func(ctx context.Context, event *HookEvent) error { return validate(event.Rows) },
 	*   }
 	* )
 	* </code>
 	**/
 
-	beforeInsert []func([]interface{})
-	afterInsert  []func([]interface{})
-	beforeUpdate []func([]interface{})
-	afterUpdate  []func([]interface{})
-	beforeFind   []func([]interface{})
-	afterFind    []func([]interface{})
-	beforeDelete []func([]interface{})
-	afterDelete  []func([]interface{})
+	beforeInsert []*handler
+	afterInsert  []*handler
+	beforeUpdate []*handler
+	afterUpdate  []*handler
+	beforeFind   []*handler
+	afterFind    []*handler
+	beforeDelete []*handler
+	afterDelete  []*handler
 
 	/**
 	 * By default, we return items as objects. You can change this for the
@@ -113,9 +116,10 @@ type query struct {
 	pendingOrderBy []string
 }
 
-//Key allow to modify the default id as pk for the table
-func (model *query) Key(key string) *query {
-	model.key = key
+//Key allow to modify the default id as pk for the table.
+//Several columns make a composite key
+func (model *SQLQuery) Key(keys ...string) *SQLQuery {
+	model.keys = keys
 	return model
 }
 
@@ -161,106 +165,130 @@ func (model *query) DateFormat(dateFormat string) *query {
 	return model
 }
 
-//BeforeInsert sets the BeforeInsert triggers
-func (model *SQLQuery) BeforeInsert(triggers []func([]interface{})) *SQLQuery {
-	model.beforeInsert = triggers
-	return model
+//Operation is the kind of statement a hook runs around
+type Operation string
+
+//Operations hooks are called for
+const (
+	OpInsert Operation = "INSERT"
+	OpUpdate Operation = "UPDATE"
+	OpFind   Operation = "SELECT"
+	OpDelete Operation = "DELETE"
+)
+
+//HookEvent is what hooks learn about the statement they run around.
+//Before hooks get the operation, the table and the structs to write;
+//finds also give their SQL and args upfront. After hooks get everything
+type HookEvent struct {
+	Operation Operation
+	Table     string
+
+	//The structs given to Insert, Update and Delete or the rows found
+	Rows []interface{}
+
+	SQL  string
+	Args []interface{}
+
+	//Rows written, or found for a select
+	RowsAffected int64
+	Duration     time.Duration
+
+	//Error of the statement; after hooks are called even if it failed
+	Err error
 }
 
-//AfterInsert sets the AfterInsert triggers
-func (model *SQLQuery) AfterInsert(triggers []func([]interface{})) *SQLQuery {
-	model.afterInsert = triggers
-	return model
+//Hook is called before or after a statement.
+//An error returned by a before hook aborts the statement, an error
+//returned by an after hook is reported too; both roll back the
+//ongoing transaction and are returned to the caller
+type Hook func(ctx context.Context, event *HookEvent) error
+
+//BeforeInsert replaces the BeforeInsert triggers, use OnBeforeInsert to add one
+func (model *SQLQuery) BeforeInsert(triggers []Hook) *SQLQuery {
+	return model.setHooks(EventBeforeInsert, triggers)
 }
 
-//BeforeUpdate sets the BeforeUpdate triggers
-func (model *SQLQuery) BeforeUpdate(triggers []func([]interface{})) *SQLQuery {
-	model.beforeUpdate = triggers
-	return model
+//AfterInsert replaces the AfterInsert triggers, use OnAfterInsert to add one
+func (model *SQLQuery) AfterInsert(triggers []Hook) *SQLQuery {
+	return model.setHooks(EventAfterInsert, triggers)
 }
 
-//AfterUpdate sets the AfterUpdate triggers
-func (model *SQLQuery) AfterUpdate(triggers []func([]interface{})) *SQLQuery {
-	model.afterUpdate = triggers
-	return model
+//BeforeUpdate replaces the BeforeUpdate triggers, use OnBeforeUpdate to add one
+func (model *SQLQuery) BeforeUpdate(triggers []Hook) *SQLQuery {
+	return model.setHooks(EventBeforeUpdate, triggers)
 }
 
-//BeforeFind sets the BeforeFind triggers
-func (model *SQLQuery) BeforeFind(triggers []func([]interface{})) *SQLQuery {
-	model.beforeFind = triggers
-	return model
+//AfterUpdate replaces the AfterUpdate triggers, use OnAfterUpdate to add one
+func (model *SQLQuery) AfterUpdate(triggers []Hook) *SQLQuery {
+	return model.setHooks(EventAfterUpdate, triggers)
 }
 
-//AfterFind sets the AfterFind triggers
-func (model *SQLQuery) AfterFind(triggers []func([]interface{})) *SQLQuery {
-	model.afterFind = triggers
-	return model
+//BeforeFind replaces the BeforeFind triggers, use OnBeforeFind to add one
+func (model *SQLQuery) BeforeFind(triggers []Hook) *SQLQuery {
+	return model.setHooks(EventBeforeFind, triggers)
 }
 
-//BeforeDelete sets the BeforeDelete triggers
-func (model *SQLQuery) BeforeDelete(triggers []func([]interface{})) *SQLQuery {
-	model.beforeDelete = triggers
-	return model
+//AfterFind replaces the AfterFind triggers, use OnAfterFind to add one
+func (model *SQLQuery) AfterFind(triggers []Hook) *SQLQuery {
+	return model.setHooks(EventAfterFind, triggers)
 }
 
-//AfterDelete sets the AfterDelete triggers
-func (model *SQLQuery) AfterDelete(triggers []func([]interface{})) *SQLQuery {
-	model.afterDelete = triggers
-	return model
+//BeforeDelete replaces the BeforeDelete triggers, use OnBeforeDelete to add one
+func (model *SQLQuery) BeforeDelete(triggers []Hook) *SQLQuery {
+	return model.setHooks(EventBeforeDelete, triggers)
 }
 
-//executebeforeInsert executes the beforeInsert triggers
-func (model *SQLQuery) executebeforeInsert() {
-	for index := 0; index < len(model.beforeInsert); index++ {
-		model.beforeInsert[index](model.result)
+//AfterDelete replaces the AfterDelete triggers, use OnAfterDelete to add one
+func (model *SQLQuery) AfterDelete(triggers []Hook) *SQLQuery {
+	return model.setHooks(EventAfterDelete, triggers)
+}
+
+//runHooks calls hooks in order and stops at the first error
+func (model *SQLQuery) runHooks(hooks []*handler, event *HookEvent) error {
+	for index := 0; index < len(hooks); index++ {
+		if err := hooks[index].hook(model.context(), event); err != nil {
+			return err
+		}
 	}
+	return nil
+}
+
+//executebeforeInsert executes the beforeInsert triggers
+func (model *SQLQuery) executebeforeInsert(event *HookEvent) error {
+	return model.runHooks(model.beforeInsert, event)
 }
 
 //executeafterInsert executes the afterInsert triggers
-func (model *SQLQuery) executeafterInsert() {
-	for index := 0; index < len(model.afterInsert); index++ {
-		model.afterInsert[index](model.result)
-	}
+func (model *SQLQuery) executeafterInsert(event *HookEvent) error {
+	return model.runHooks(model.afterInsert, event)
 }
 
 //executebeforeUpdate executes the beforeUpdate triggers
-func (model *SQLQuery) executebeforeUpdate() {
-	for index := 0; index < len(model.beforeUpdate); index++ {
-		model.beforeUpdate[index](model.result)
-	}
+func (model *SQLQuery) executebeforeUpdate(event *HookEvent) error {
+	return model.runHooks(model.beforeUpdate, event)
 }
 
 //executeafterUpdate executes the afterUpdate triggers
-func (model *SQLQuery) executeafterUpdate() {
-	for index := 0; index < len(model.afterUpdate); index++ {
-		model.afterUpdate[index](model.result)
-	}
+func (model *SQLQuery) executeafterUpdate(event *HookEvent) error {
+	return model.runHooks(model.afterUpdate, event)
 }
 
 //executebeforeFind executes the beforeFind triggers
-func (model *SQLQuery) executebeforeFind() {
-	for index := 0; index < len(model.beforeFind); index++ {
-		model.beforeFind[index](model.result)
-	}
+func (model *SQLQuery) executebeforeFind(event *HookEvent) error {
+	return model.runHooks(model.beforeFind, event)
 }
 
 //executeafterFind executes the afterFind triggers
-func (model *SQLQuery) executeafterFind() {
-	for index := 0; index < len(model.afterFind); index++ {
-		model.afterFind[index](model.result)
-	}
+func (model *SQLQuery) executeafterFind(event *HookEvent) error {
+	return model.runHooks(model.afterFind, event)
 }
 
 //executebeforeDelete executes the beforeDelete triggers
-func (model *SQLQuery) executebeforeDelete() {
-	for index := 0; index < len(model.beforeDelete); index++ {
-		model.beforeDelete[index](model.result)
-	}
+func (model *SQLQuery) executebeforeDelete(event *HookEvent) error {
+	return model.runHooks(model.beforeDelete, event)
 }
 
 //executeafterDelete executes the afterDelete triggers
-func (model *SQLQuery) executeafterDelete() {
-	for index := 0; index < len(model.afterDelete); index++ {
-		model.afterDelete[index](model.result)
-	}
+func (model *SQLQuery) executeafterDelete(event *HookEvent) error {
+	return model.runHooks(model.afterDelete, event)
 }
@@ -0,0 +1,38 @@
+//go:build go1.21
+// +build go1.21
+
+package query
+
+import (
+	"bytes"
+	"log/slog"
+	"regexp"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/mathieunls/qw/connector"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlogLogger(t *testing.T) {
+	s := []string{
+		"mock:mock@mock(127.0.0.1:3306)/mock",
+	}
+	cnx := new(CnxMock)
+	m, err := NewSQLQuery("bugs", s, cnx)
+
+	assert := assert.New(t)
+	assert.Nil(err)
+
+	var out bytes.Buffer
+	m.Logger(connector.SlogLogger(slog.New(slog.NewTextHandler(&out, &slog.HandlerOptions{Level: slog.LevelDebug}))))
+
+	cnx.Mock.ExpectQuery(regexp.QuoteMeta("SELECT  count(1)  FROM bugs")).
+		WillReturnRows(sqlmock.NewRows([]string{"c"}).AddRow(3))
+
+	_, err = m.CountAll()
+	assert.Nil(err)
+	assert.Regexp(`level=DEBUG msg="qw: statement" operation=SELECT table=bugs sql="SELECT  count\(1\)  FROM bugs" args=\[\] duration=\S+ rows=1`, out.String())
+
+	assert.Nil(cnx.Mock.ExpectationsWereMet())
+}
@@ -0,0 +1,120 @@
+package query
+
+import (
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mathieunls/qw/connector"
+)
+
+//SlowQuery describes a statement that ran longer than the threshold
+//given to SlowQueries
+type SlowQuery struct {
+	SQL string
+
+	//The bound values, redacted as the logs are by RedactArgs
+	Args     []interface{}
+	Duration time.Duration
+
+	//file:line of the code that ran the statement
+	Caller string
+
+	//EXPLAIN output of the selects, when asked for, one map per row
+	Plan       []map[string]interface{}
+	ExplainErr error
+}
+
+//slowQueries is the slow statements setup of a model
+type slowQueries struct {
+	threshold time.Duration
+	report    func(SlowQuery)
+	explain   bool
+}
+
+//packageDir is the directory of the query package, skipped when
+//looking for the caller of a statement
+var packageDir = func() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Dir(file)
+}()
+
+//SlowQueries reports the statements lasting longer than threshold.
+//When explain is set, the EXPLAIN plan of the slow selects is captured
+//too; writes are never explained.
+//A nil report stops the reporting
+//model.SlowQueries(200*time.Millisecond, func(slow query.SlowQuery) { ... }, true)
+func (model *SQLQuery) SlowQueries(threshold time.Duration, report func(SlowQuery), explain bool) *SQLQuery {
+	if report == nil {
+		model.slow = nil
+		return model
+	}
+	model.slow = &slowQueries{threshold, report, explain}
+	return model
+}
+
+//reportSlow reports statement if it ran longer than the threshold.
+//Selects are explained as written, the middlewares rewriting them
+//again on the way
+func (model *SQLQuery) reportSlow(statement *connector.Statement, written *connector.Statement, duration time.Duration) {
+	if model.slow == nil || duration < model.slow.threshold {
+		return
+	}
+
+	slow := SlowQuery{
+		SQL:      statement.SQL,
+		Args:     model.reportedArgs(statement.Args),
+		Duration: duration,
+		Caller:   caller(),
+	}
+	if model.slow.explain && statement.Operation == string(OpFind) {
+		slow.Plan, slow.ExplainErr = model.explain(written)
+	}
+	model.slow.report(slow)
+}
+
+//explain returns the EXPLAIN output of the select statement as the
+//dialect words it. It runs through the middlewares but isn't tracked,
+//and leaves the last query alone
+func (model *SQLQuery) explain(statement *connector.Statement) ([]map[string]interface{}, error) {
+
+	explained, _, err := model.explainOf(statement, false)
+	if err != nil {
+		return nil, err
+	}
+
+	lastQuery := model.lastQuery
+	columns, rows, err := model.explainRows(model.statementContext(), explained)
+	model.lastQuery = lastQuery
+	if err != nil {
+		return nil, err
+	}
+
+	plan := make([]map[string]interface{}, len(rows))
+	for index := 0; index < len(rows); index++ {
+		plan[index] = make(map[string]interface{}, len(columns))
+		for c := 0; c < len(columns); c++ {
+			plan[index][columns[c]] = rows[index][c]
+		}
+	}
+	return plan, nil
+}
+
+//caller returns the file:line of the first frame outside of the
+//package, tests aside
+func caller() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+
+	for {
+		frame, more := frames.Next()
+		if filepath.Dir(frame.File) != packageDir || strings.HasSuffix(frame.File, "_test.go") {
+			return frame.File + ":" + strconv.Itoa(frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
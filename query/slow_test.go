@@ -0,0 +1,144 @@
+package query
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/mathieunls/qw/connector"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlowQueries(t *testing.T) {
+	s := []string{
+		"mock:mock@mock(127.0.0.1:3306)/mock",
+	}
+	cnx := new(CnxMock)
+	m, err := NewSQLQuery("bugs", s, cnx)
+
+	type Bug struct {
+		ID   int    `db:"id"`
+		Name string `db:"name"`
+	}
+	m.returnType = new(Bug)
+
+	assert := assert.New(t)
+	assert.Nil(err)
+
+	slows := []SlowQuery{}
+	report := func(slow SlowQuery) {
+		slows = append(slows, slow)
+	}
+
+	cnx.Mock.ExpectPrepare(regexp.QuoteMeta("SELECT  *  FROM bugs WHERE name = ?")).
+		ExpectQuery().
+		WithArgs("crash").
+		WillDelayFor(20 * time.Millisecond).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "crash"))
+	cnx.Mock.ExpectQuery(regexp.QuoteMeta("EXPLAIN SELECT  *  FROM bugs WHERE name = ?")).
+		WithArgs("crash").
+		WillReturnRows(sqlmock.NewRows([]string{"table", "type", "rows"}).AddRow("bugs", "ALL", 1000))
+	cnx.Mock.ExpectQuery(regexp.QuoteMeta("SELECT  count(1)  FROM bugs")).
+		WillReturnRows(sqlmock.NewRows([]string{"c"}).AddRow(1))
+	cnx.Mock.ExpectPrepare(regexp.QuoteMeta("UPDATE bugs SET name = ? WHERE id = ?")).
+		ExpectExec().
+		WithArgs("crash", 1).
+		WillDelayFor(20 * time.Millisecond).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	m.SlowQueries(10*time.Millisecond, report, true)
+
+	_, err = m.WhereValue("name", "crash").FindAll()
+	assert.Nil(err)
+	_, err = m.CountAll()
+	assert.Nil(err)
+	_, err = m.Update(&Bug{1, "crash"})
+	assert.Nil(err)
+
+	//The quick count is not reported, the update is but not explained
+	assert.Len(slows, 2)
+
+	assert.Equal("SELECT  *  FROM bugs WHERE name = ?", slows[0].SQL)
+	assert.Equal([]interface{}{"crash"}, slows[0].Args)
+	assert.True(slows[0].Duration >= 10*time.Millisecond)
+	assert.True(strings.Contains(slows[0].Caller, "slow_test.go:"), slows[0].Caller)
+	assert.Nil(slows[0].ExplainErr)
+	assert.Equal([]map[string]interface{}{{"table": "bugs", "type": "ALL", "rows": int64(1000)}}, slows[0].Plan)
+
+	assert.Equal("UPDATE bugs SET name = ? WHERE id = ?", slows[1].SQL)
+	assert.Nil(slows[1].Plan)
+
+	cnx.Mock.ExpectPrepare(regexp.QuoteMeta("SELECT  *  FROM bugs WHERE name = ?")).
+		ExpectQuery().
+		WithArgs("crash").
+		WillDelayFor(20 * time.Millisecond).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "crash"))
+	cnx.Mock.ExpectQuery(regexp.QuoteMeta("EXPLAIN QUERY PLAN SELECT  *  FROM bugs WHERE name = ?")).
+		WithArgs("crash").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "parent", "notused", "detail"}).AddRow(2, 0, 0, "SCAN bugs"))
+
+	_, err = m.Dialect(SQLite).WhereValue("name", "crash").FindAll()
+	assert.Nil(err)
+	assert.Len(slows, 3)
+	assert.Equal("SCAN bugs", slows[2].Plan[0]["detail"])
+	assert.Equal("SELECT  *  FROM bugs WHERE name = ?", m.LastQuery())
+
+	m.SlowQueries(0, nil, false)
+	assert.Nil(m.slow)
+
+	assert.Nil(cnx.Mock.ExpectationsWereMet())
+}
+
+func TestSlowQueriesThroughMiddlewares(t *testing.T) {
+	s := []string{
+		"mock:mock@mock(127.0.0.1:3306)/mock",
+	}
+	tenant := func(next connector.Exec) connector.Exec {
+		return func(ctx context.Context, statement *connector.Statement) error {
+			if statement.Operation == "SELECT" || statement.Operation == "EXPLAIN" {
+				statement.SQL += " AND tenant = ?"
+				statement.Args = append(statement.Args, 42)
+			}
+			return next(ctx, statement)
+		}
+	}
+
+	cnx := new(CnxMock)
+	m, err := NewSQLQuery("bugs", s, connector.Use(cnx, tenant))
+
+	type Bug struct {
+		ID int `db:"id"`
+	}
+	m.returnType = new(Bug)
+
+	assert := assert.New(t)
+	assert.Nil(err)
+
+	slows := []SlowQuery{}
+	m.RedactArgs(true).SlowQueries(10*time.Millisecond, func(slow SlowQuery) {
+		slows = append(slows, slow)
+	}, true)
+
+	cnx.Mock.ExpectPrepare(regexp.QuoteMeta("SELECT  *  FROM bugs WHERE name = ? AND tenant = ?")).
+		ExpectQuery().
+		WithArgs("crash", 42).
+		WillDelayFor(20 * time.Millisecond).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	cnx.Mock.ExpectQuery(regexp.QuoteMeta("EXPLAIN SELECT  *  FROM bugs WHERE name = ? AND tenant = ?")).
+		WithArgs("crash", 42).
+		WillReturnRows(sqlmock.NewRows([]string{"table", "type"}).AddRow("bugs", "ALL"))
+
+	_, err = m.WhereValue("name", "crash").FindAll()
+	assert.Nil(err)
+
+	assert.Len(slows, 1)
+	assert.Equal("SELECT  *  FROM bugs WHERE name = ? AND tenant = ?", slows[0].SQL)
+	assert.Equal([]interface{}{"[redacted]", "[redacted]"}, slows[0].Args)
+	assert.Nil(slows[0].ExplainErr)
+	assert.Equal("ALL", slows[0].Plan[0]["type"])
+
+	assert.Nil(cnx.Mock.ExpectationsWereMet())
+}
@@ -1,16 +1,68 @@
 package query
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"reflect"
+	"regexp"
 	"strconv"
 
 	"strings"
+	"time"
 
 	"github.com/mathieunls/qw/connector"
 )
 
+//SQL dialects a SQLQuery can speak
+const (
+	MySQL    = "mysql"
+	Postgres = "postgres"
+	SQLite   = "sqlite"
+)
+
+var (
+	//ErrLockOutsideTransaction is returned when a locking select runs
+	//without a transaction opened by Begin
+	ErrLockOutsideTransaction = errors.New("qw: row locks must be used inside a transaction")
+
+	//ErrLockUnsupported is returned when the dialect has no row locks
+	ErrLockUnsupported = errors.New("qw: row locks are not supported by this dialect")
+
+	//ErrStaleObject is returned by Update when the version column of the
+	//row changed since the struct was read
+	ErrStaleObject = errors.New("qw: stale object, the row was modified concurrently")
+
+	//ErrNoReturnType is returned when selecting into structs without
+	//return type, see ReturnType
+	ErrNoReturnType = errors.New("qw: no return type, call ReturnType first")
+
+	//ErrNoPrimaryKey is returned when no struct field maps on the primary key
+	ErrNoPrimaryKey = errors.New("qw: no field maps on the primary key")
+
+	//ErrLockModifierWithoutLock is returned when SkipLocked or NoWait are
+	//used without LockForUpdate or SharedLock
+	ErrLockModifierWithoutLock = errors.New("qw: SkipLocked and NoWait require LockForUpdate or SharedLock")
+
+	//ErrLockAggregate is returned when a Postgres row lock is asked for
+	//a select with aggregates, GROUP BY or DISTINCT, which Postgres rejects
+	ErrLockAggregate = errors.New("qw: row locks can't be used with aggregates, GROUP BY or DISTINCT on Postgres")
+
+	//ErrTxOpen is returned when Begin is called while a transaction
+	//is still open
+	ErrTxOpen = errors.New("qw: a transaction is already open")
+)
+
+//aggregated matches the select columns Postgres can't lock rows for
+var aggregated = regexp.MustCompile(`(?i)^\s*distinct\b|\b(count|sum|avg|min|max)\s*\(`)
+
+//runner is what both *sql.DB and *sql.Tx offer to run statements
+type runner interface {
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
 //SQLQuery represents a SQLQuery struct that offers helper function to safely
 //interact with the database in go
 type SQLQuery struct {
@@ -22,8 +74,8 @@ type SQLQuery struct {
 	// Stores custom errors that can be reported.
 	lastError error
 
-	//The primary key of the table. Used as the 'id' throughout.
-	key string
+	//The primary key columns of the table. Used as the 'id' throughout.
+	keys []string
 
 	// Field name to use for the created time column in the DB table if
 	// setCreated is enabled
@@ -66,28 +118,27 @@ type SQLQuery struct {
 	/**
 	* Observer Slices
 	*
-	* Each slice can contain callback functions
+	* Each slice can contain hooks
 	* which will be called during each event.
 	*
 	* <code>
 	*  model.BeforeInsert(
-	*    []func{
-	*        func() string{ return "Hello" },
-	*        func() string{ return " " },
-	*        func() string{ return "World" }
+	*    []Hook{
+	*        func(ctx context.Context, event *HookEvent) error { return nil },
+	*        func(ctx context.Context, event *HookEvent) error { return validate(event.Rows) },
 	*   }
 	* )
 	* </code>
 	**/
 
-	beforeInsert []func([]interface{})
-	afterInsert  []func([]interface{})
-	beforeUpdate []func([]interface{})
-	afterUpdate  []func([]interface{})
-	beforeFind   []func([]interface{})
-	afterFind    []func([]interface{})
-	beforeDelete []func([]interface{})
-	afterDelete  []func([]interface{})
+	beforeInsert []*handler
+	afterInsert  []*handler
+	beforeUpdate []*handler
+	afterUpdate  []*handler
+	beforeFind   []*handler
+	afterFind    []*handler
+	beforeDelete []*handler
+	afterDelete  []*handler
 
 	/**
 	 * By default, we return items as objects. You can change this for the
@@ -97,6 +148,9 @@ type SQLQuery struct {
 	 */
 	returnType interface{}
 
+	//why the last ReturnType given was rejected, if it was
+	returnTypeError error
+
 	/**
 	 * Holds the return type temporarily when using the
 	 * as_map() methods
@@ -117,6 +171,36 @@ type SQLQuery struct {
 	//actual database connection
 	db *sql.DB
 
+	//ongoing transaction, if any, with the context and span it runs in
+	tx     *sql.Tx
+	txCtx  context.Context
+	txSpan Span
+
+	//context of the statements and hooks, background by default
+	ctx context.Context
+
+	//middlewares of the connection every statement runs through
+	middlewares []connector.Middleware
+
+	//where statements are logged, and whether their args are hidden
+	logger     connector.Logger
+	redactArgs bool
+
+	//reporting of the statements lasting too long, if any
+	slow *slowQueries
+
+	//tracer of the statements and transactions, if any
+	tracer Tracer
+
+	//collector of the statement metrics, if any
+	collector Collector
+
+	//SQL dialect spoken by db, MySQL by default
+	dialect string
+
+	//Names the untagged fields and the tables
+	naming NamingStrategy
+
 	//return struct holder
 	result []interface{}
 
@@ -138,13 +222,115 @@ type SQLQuery struct {
 	pendingGroupBy []string
 	pendingHaving  []string
 	pendingOrderBy []string
+
+	// Common table expressions prefixed to the select, and whether
+	// one of them is recursive
+	pendingWiths  []string
+	recursiveWith bool
+
+	// Table the select reads from when it isn't tableName (e.g. a CTE)
+	pendingFrom string
+
+	// Bound values for the placeholders of the pending select.
+	// CTE values come first as the WITH clause leads the statement.
+	pendingWithArgs []interface{}
+	pendingArgs     []interface{}
+
+	// Column used for optimistic locking, if any. Update only writes
+	// rows whose version didn't move and increments it.
+	versionField string
+
+	// Error met while building the pending query, returned when it runs
+	pendingError error
+
+	// Row lock of the pending select (FOR UPDATE, FOR SHARE) and its
+	// modifiers (SKIP LOCKED, NOWAIT)
+	pendingLock         string
+	pendingLockModifier string
 }
 
 //NewSQLQuery returns a pointer to a new SQLModel with all default values setted
 func NewSQLQuery(table string, dbCons []string, cnxOpener connector.Cnx) (*SQLQuery, error) {
+	model := newSQLQuery(table)
+
+	if dialecter, ok := cnxOpener.(connector.Dialecter); ok && dialecter.Dialect() != "" {
+		model.dialect = dialecter.Dialect()
+	}
+	if chainer, ok := cnxOpener.(connector.Chainer); ok {
+		model.middlewares = chainer.Middlewares()
+	}
+	if logged, ok := cnxOpener.(connector.Logged); ok {
+		model.logger = logged.Logger()
+	}
+
+	var err error
+	model.db, err = cnxOpener.OpenCnx(dbCons)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return model, nil
+
+}
+
+//Dialect sets the SQL dialect spoken by the connection.
+//It is guessed from the connector when possible.
+//Statements are written with ? placeholders, Postgres gets them
+//numbered $1, $2... once through the middlewares
+func (model *SQLQuery) Dialect(dialect string) *SQLQuery {
+	model.dialect = dialect
+	return model
+}
+
+//VersionField sets the column used for optimistic locking.
+//Tagging a field with `db:"version,version"` has the same effect
+func (model *SQLQuery) VersionField(versionField string) *SQLQuery {
+	model.versionField = versionField
+	return model
+}
+
+//Logger sets where statements are logged: at debug level with their
+//duration and row count, at error level when they fail.
+//It defaults to the logger of the connector
+func (model *SQLQuery) Logger(logger connector.Logger) *SQLQuery {
+	if logger == nil {
+		logger = connector.NopLogger{}
+	}
+	model.logger = logger
+	return model
+}
+
+//RedactArgs hides the values bound to the statements from the logs
+func (model *SQLQuery) RedactArgs(redact bool) *SQLQuery {
+	model.redactArgs = redact
+	return model
+}
+
+//Subquery returns a new SQLQuery on table sharing the model connection.
+//It is meant to build the sub-selects given to With and WithRecursive.
+func (model *SQLQuery) Subquery(table string) *SQLQuery {
+	sub := newSQLQuery(table)
+	sub.db = model.db
+	sub.tx = model.tx
+	sub.txCtx = model.txCtx
+	sub.dialect = model.dialect
+	sub.naming = model.naming
+	sub.middlewares = model.middlewares
+	sub.logger = model.logger
+	sub.redactArgs = model.redactArgs
+	sub.slow = model.slow
+	sub.tracer = model.tracer
+	sub.collector = model.collector
+	return sub
+}
+
+//newSQLQuery returns a SQLQuery with all default values setted but
+//without any connection
+func newSQLQuery(table string) *SQLQuery {
 	model := new(SQLQuery)
 	model.tableName = table
-	model.key = "id"
+	model.keys = []string{"id"}
 	model.createdField = "created_on"
 	model.modifiedField = "modified_on"
 	model.deletedField = "deleted"
@@ -152,25 +338,21 @@ func NewSQLQuery(table string, dbCons []string, cnxOpener connector.Cnx) (*SQLQu
 	model.setModified = false
 	model.softDeletes = false
 	model.dateFormat = "datetime"
+	model.dialect = MySQL
+	model.naming = DefaultNaming
+	model.logger = connector.NopLogger{}
 	model.pendingSelects = []string{}
 	model.pendingWheres = []string{}
 	model.pendingJoins = []string{}
 	model.pendingUnions = []string{}
 	model.pendingGroupBy = []string{}
 	model.pendingOrderBy = []string{}
+	model.pendingWiths = []string{}
 	model.lastQuery = ""
 	model.limit = -1
 	model.offset = -1
 
-	var err error
-	model.db, err = cnxOpener.OpenCnx(dbCons)
-
-	if err != nil {
-		return nil, err
-	}
-
-	return model, nil
-
+	return model
 }
 
 //Cleans up everything and make the model ready
@@ -183,64 +365,134 @@ func (model *SQLQuery) cleanup(err error) {
 	model.pendingUnions = []string{}
 	model.pendingGroupBy = []string{}
 	model.pendingOrderBy = []string{}
+	model.pendingWiths = []string{}
+	model.recursiveWith = false
+	model.pendingFrom = ""
+	model.pendingWithArgs = nil
+	model.pendingArgs = nil
+	model.pendingError = nil
+	model.pendingLock = ""
+	model.pendingLockModifier = ""
 	model.limit = -1
 	model.offset = -1
 	model.lastError = err
 }
 
-// Adapt []sql.RawBytes to the model.result struct using `db` Tag
-func (model *SQLQuery) reflectResult(values []sql.RawBytes, columns []string) interface{} {
+//conn returns the ongoing transaction if any, the connection otherwise
+func (model *SQLQuery) conn() runner {
+	if model.tx != nil {
+		return model.tx
+	}
+	return model.db
+}
 
-	colMap := make(map[string]int)
+//Begin starts a transaction in which every following statement
+//of the model runs until Commit or Rollback.
+//It returns ErrTxOpen if the previous one is still open
+func (model *SQLQuery) Begin() error {
+	if model.tx != nil {
+		return ErrTxOpen
+	}
+	ctx := model.context()
+	var span Span
+	if model.tracer != nil {
+		ctx, span = model.tracer.Start(ctx, "transaction", map[string]interface{}{
+			"db.system": model.dbSystem(),
+		})
+	}
 
-	//Index the columns by name for O(1) access
-	for index := 0; index < len(columns); index++ {
-		colMap[columns[index]] = index
+	tx, err := model.db.BeginTx(ctx, nil)
+	if err != nil {
+		if span != nil {
+			span.End(err)
+		}
+		return err
 	}
+	model.tx = tx
+	model.txCtx = ctx
+	model.txSpan = span
+	return nil
+}
 
-	//Reflect on model.returnType for reading/writing on fields
-	reflected := reflect.New(reflect.TypeOf(model.returnType).Elem()).Elem()
-	typeOfT := reflected.Type()
+//endTx forgets the transaction once committed or rolled back
+func (model *SQLQuery) endTx(outcome string, err error) {
+	if model.txSpan != nil {
+		model.txSpan.SetAttributes(map[string]interface{}{
+			"db.transaction.outcome": outcome,
+		})
+		model.txSpan.End(err)
+	}
+	model.tx = nil
+	model.txCtx = nil
+	model.txSpan = nil
+}
 
-	//For each field in the model.result
-	for i := 0; i < reflected.NumField(); i++ {
+//Commit commits the transaction started by Begin
+func (model *SQLQuery) Commit() error {
+	if model.tx == nil {
+		return sql.ErrTxDone
+	}
+	err := model.tx.Commit()
+	model.endTx("commit", err)
+	return err
+}
 
-		dbKey, _ := typeOfT.Field(i).Tag.Lookup("db")
+//WithContext sets the context the following statements and their
+//hooks run with
+//model.WithContext(r.Context()).Insert(&user)
+func (model *SQLQuery) WithContext(ctx context.Context) *SQLQuery {
+	model.ctx = ctx
+	return model
+}
 
-		//Check if that tag is present in the resultset
-		if valKey, ok := colMap[dbKey]; ok {
+//context returns the context set by WithContext, the background one otherwise
+func (model *SQLQuery) context() context.Context {
+	if model.ctx == nil {
+		return context.Background()
+	}
+	return model.ctx
+}
 
-			//Get the value from the resultset
-			value := values[valKey]
+//abort rolls back the ongoing transaction, if any, after a hook
+//failed and returns the hook error
+func (model *SQLQuery) abort(err error) error {
+	if model.tx != nil {
+		model.Rollback()
+	}
+	return err
+}
 
-			//Swith on target type for byte to type convertion
-			typeOfKey := reflected.Field(i).Type()
-			switch typeOfKey.String() {
-			case "int":
-				intValue, _ := strconv.ParseInt(string(value), 10, 64)
-				reflected.Field(i).SetInt(intValue)
-				break
-			case "string":
-				reflected.Field(i).SetString(string(value))
-				break
-			case "float64":
-				floatValue, _ := strconv.ParseFloat(string(value), 64)
-				reflected.Field(i).SetFloat(floatValue)
-				break
-			case "float32":
-				floatValue, _ := strconv.ParseFloat(string(value), 32)
-				reflected.Field(i).SetFloat(floatValue)
-				break
-			}
-		}
+//Rollback aborts the transaction started by Begin
+func (model *SQLQuery) Rollback() error {
+	if model.tx == nil {
+		return sql.ErrTxDone
 	}
+	err := model.tx.Rollback()
+	model.endTx("rollback", err)
+	return err
+}
 
-	return reflected.Interface()
+//selectArgs returns the bound values of the pending select in
+//placeholder order
+func (model *SQLQuery) selectArgs() []interface{} {
+	args := []interface{}{}
+	args = append(args, model.pendingWithArgs...)
+	return append(args, model.pendingArgs...)
 }
 
 // composeSelectString merges all the select clauses together
 func (model *SQLQuery) composeSelectString() string {
-	selectString := "SELECT "
+	selectString := ""
+
+	if len(model.pendingWiths) > 0 {
+		selectString += "WITH "
+		if model.recursiveWith {
+			selectString += "RECURSIVE "
+		}
+		selectString += strings.Join(model.pendingWiths, ", ") + " "
+	}
+
+	selectString += "SELECT "
 
 	if len(model.pendingSelects) > 0 {
 		selectString += strings.Join(model.pendingSelects, ", ")
@@ -248,7 +500,11 @@ func (model *SQLQuery) composeSelectString() string {
 		selectString += " * "
 	}
 
-	selectString += " FROM " + model.tableName
+	if model.pendingFrom != "" {
+		selectString += " FROM " + model.pendingFrom
+	} else {
+		selectString += " FROM " + model.table(model.returnType)
+	}
 
 	if len(model.pendingJoins) > 0 {
 		selectString += strings.Join(model.pendingJoins, " ")
@@ -280,204 +536,612 @@ func (model *SQLQuery) composeSelectString() string {
 		selectString += " OFFSET  " + strconv.Itoa(model.offset)
 	}
 
+	if lock := model.lockClause(); lock != "" {
+		selectString += " " + lock
+	}
+
 	model.lastQuery = selectString
 	return selectString
 }
 
-// executeSelectQuery queries the database
-func (model *SQLQuery) executeSelectQuery() error {
+// ReturnType sets the struct rows are returned as. proto is a struct
+//or a pointer to one, whose fields must be mappable on columns
+//	model.ReturnType(Bug{})
+func (model *SQLQuery) ReturnType(proto interface{}) *SQLQuery {
+
+	t := reflect.TypeOf(proto)
+	if t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
 
-	model.executebeforeInsert()
+	model.returnTypeError = model.checkReturnType(t)
+	if model.returnTypeError == nil {
+		model.returnType = reflect.New(t).Interface()
+	}
+	return model
+}
 
-	selectString := model.composeSelectString()
-	stmtOut, err := model.db.Prepare(selectString)
-	model.lastQuery = selectString
+// Into runs the ongoing select into dest, a *T for the first row,
+//a *[]T or a *[]*T for all of them, T being a struct with mappable
+//fields. The model return type is left untouched
+func (model *SQLQuery) Into(dest interface{}) error {
 
-	if err != nil {
+	target := reflect.ValueOf(dest)
+	if target.Kind() != reflect.Ptr || target.IsNil() {
+		err := fmt.Errorf("qw: Into expects a non nil pointer, got %T", dest)
 		model.cleanup(err)
 		return err
 	}
-	defer stmtOut.Close()
-	rows, err := stmtOut.Query()
+	target = target.Elem()
+
+	elemType := target.Type()
+	isSlice := elemType.Kind() == reflect.Slice
+	isPtr := false
+	if isSlice {
+		elemType = elemType.Elem()
+		if elemType.Kind() == reflect.Ptr {
+			elemType = elemType.Elem()
+			isPtr = true
+		}
+	}
 
-	columns, err := rows.Columns()
-	if err != nil {
+	if err := model.checkReturnType(elemType); err != nil {
 		model.cleanup(err)
 		return err
 	}
 
-	// Make a slice for the values
-	values := make([]sql.RawBytes, len(columns))
+	returnType, returnTypeError := model.returnType, model.returnTypeError
+	model.returnType, model.returnTypeError = reflect.New(elemType).Interface(), nil
+	if !isSlice && model.limit <= 0 {
+		model.Limit(1)
+	}
+	err := model.executeSelectQuery()
+	model.returnType, model.returnTypeError = returnType, returnTypeError
 
-	// rows.Scan wants '[]interface{}' as an argument, so we must copy the
-	// references into such a slice
-	// See http://code.google.com/p/go-wiki/wiki/InterfaceSlice for details
-	scanArgs := make([]interface{}, len(values))
-	for i := range values {
-		scanArgs[i] = &values[i]
+	if err != nil {
+		return err
 	}
 
-	// Fetch rows
-	for rows.Next() {
-		// get RawBytes from data
+	if !isSlice {
+		if len(model.result) == 0 {
+			return sql.ErrNoRows
+		}
+		target.Set(reflect.ValueOf(model.result[0]))
+		return nil
+	}
 
-		err = rows.Scan(scanArgs...)
-		if err != nil {
-			model.cleanup(err)
-			return err
+	rows := reflect.MakeSlice(target.Type(), 0, len(model.result))
+	for index := 0; index < len(model.result); index++ {
+		row := reflect.ValueOf(model.result[index])
+		if isPtr {
+			pointer := reflect.New(elemType)
+			pointer.Elem().Set(row)
+			row = pointer
 		}
+		rows = reflect.Append(rows, row)
+	}
+	target.Set(rows)
+	return nil
+}
 
-		model.result = append(model.result, model.reflectResult(values, columns))
+// checkReturnType reports whether rows can be returned as t
+func (model *SQLQuery) checkReturnType(t reflect.Type) error {
+	if t == nil || t.Kind() != reflect.Struct || t == timeType {
+		return fmt.Errorf("qw: return type must be a struct, got %v", t)
 	}
-	if err = rows.Err(); err != nil {
+	if len(model.metaOf(t).fields) == 0 {
+		return fmt.Errorf("qw: return type %v has no field mappable on a column", t)
+	}
+	return nil
+}
+
+// executeSelectQuery queries the database
+func (model *SQLQuery) executeSelectQuery() error {
+
+	if model.returnTypeError != nil || model.returnType == nil {
+		err := model.returnTypeError
+		if err == nil {
+			err = ErrNoReturnType
+		}
 		model.cleanup(err)
 		return err
 	}
 
-	model.executeafterInsert()
+	event := &HookEvent{
+		Operation: OpFind,
+		Table:     model.selectTable(),
+		SQL:       model.composeSelectString(),
+		Args:      model.selectArgs(),
+	}
+	if err := model.executebeforeFind(event); err != nil {
+		model.cleanup(err)
+		return model.abort(err)
+	}
+
+	returnType := reflect.TypeOf(model.returnType).Elem()
+	meta := model.metaOf(returnType)
+	if meta.err != nil {
+		model.cleanup(meta.err)
+		return meta.err
+	}
 
-	model.cleanup(nil)
+	start := time.Now()
+	model.result = []interface{}{}
+	err := model.runSelect(func(columns []string, rows *sql.Rows) (int, error) {
 
-	return nil
-}
+		//Map the columns on the fields once for all the rows
+		plan := meta.plan(columns)
 
-// Debug prints all the select clauses to the consol
-func (model *SQLQuery) Debug() {
+		// rows.Scan wants '[]interface{}' as an argument, filled with the
+		// address of each field, or a converting scanner, for every row
+		scanArgs := make([]interface{}, len(columns))
+		scanners := make([]fieldScanner, len(columns))
+
+		// Fetch rows
+		for rows.Next() {
+			reflected := reflect.New(returnType).Elem()
+			meta.destinations(reflected, plan, scanners, scanArgs)
+
+			if err := rows.Scan(scanArgs...); err != nil {
+				return len(model.result), err
+			}
+			if err := afterFind(model.context(), reflected); err != nil {
+				return len(model.result), err
+			}
 
-	fmt.Println("selects:" + strings.Join(model.pendingSelects, ", "))
-	fmt.Println("wheres:" + strings.Join(model.pendingWheres, " AND "))
-	fmt.Println("joins:" + strings.Join(model.pendingJoins, " "))
-	fmt.Println("unions:" + strings.Join(model.pendingUnions, " "))
-	fmt.Println("group by:" + strings.Join(model.pendingUnions, ", "))
+			model.result = append(model.result, reflected.Interface())
+		}
+		return len(model.result), nil
+	})
+
+	event.Rows = model.result
+	event.RowsAffected = int64(len(model.result))
+	if err = model.finish(event, start, err, model.executeafterFind); err != nil {
+		model.lastError = err
+	}
+	return err
 }
 
-// Join add a join clause to the ongoing select
-//model.Join("myOtherTable", "mytable.id = myOtherTable.id", "left")
-//will produce left join myOtherTable on mytable.id = myOtherTable.id
-func (model *SQLQuery) Join(table string, condition string, joinType string) *SQLQuery {
-	model.pendingJoins = append(model.pendingJoins, joinType+" JOIN "+" "+table+" ON "+condition)
-	return model
+//selectTable returns the table the pending select reads from
+func (model *SQLQuery) selectTable() string {
+	if model.pendingFrom != "" {
+		return model.pendingFrom
+	}
+	return model.table(model.returnType)
 }
 
-// Union adds a union clause
-func (model *SQLQuery) Union(selectString string) *SQLQuery {
-	model.pendingUnions = append(model.pendingUnions, selectString)
-	return model
+//write runs statement on data between the before and after lifecycle
+//methods of data and hooks of its operation
+func (model *SQLQuery) write(operation Operation, data interface{},
+	before func(*HookEvent) error, after func(*HookEvent) error,
+	statement func(data interface{}, event *HookEvent) (bool, error)) (bool, error) {
+
+	model.result = []interface{}{data}
+	event := &HookEvent{
+		Operation: operation,
+		Table:     model.table(data),
+		Rows:      model.result,
+	}
+	if err := beforeLifecycle(model.context(), operation, data); err != nil {
+		return false, model.abort(err)
+	}
+	if err := before(event); err != nil {
+		return false, model.abort(err)
+	}
+
+	start := time.Now()
+	done, err := statement(data, event)
+	if err == nil {
+		if err = afterLifecycle(model.context(), operation, data); err != nil {
+			model.abort(err)
+		}
+	}
+	if err = model.finish(event, start, err, after); err != nil {
+		return false, err
+	}
+	return done, nil
 }
 
-// OrWhere adds a OrWhere clause
-func (model *SQLQuery) OrWhere(field string, value string) *SQLQuery {
-	return model.Where(" OR "+field, value)
+//finish completes event with the statement outcome and runs the after
+//hooks. The statement error prevails over the hook one
+func (model *SQLQuery) finish(event *HookEvent, start time.Time, err error, after func(*HookEvent) error) error {
+	event.Duration = time.Since(start)
+	event.Err = err
+	if hookErr := after(event); hookErr != nil {
+		model.abort(hookErr)
+		if err == nil {
+			return hookErr
+		}
+	}
+	return err
 }
 
-// WhereIn adds a WhereIn clause
-func (model *SQLQuery) WhereIn(field string, values []string) *SQLQuery {
+// runSelect runs the ongoing select and hands its rows to scan, which
+//returns how many it read.
+//The model is cleaned up afterward
+func (model *SQLQuery) runSelect(scan func(columns []string, rows *sql.Rows) (int, error)) error {
 
-	return model.Where(field+" IN", strings.Join(model.pendingSelects, ", "))
-}
+	if err := model.checkPending(); err != nil {
+		model.cleanup(err)
+		return err
+	}
 
-// OrWhereIn adds a OrWhereIn clause
-func (model *SQLQuery) OrWhereIn(field string, values []string) *SQLQuery {
+	statement := model.selectStatement()
+	ctx, done := model.track(statement)
+	count, err := model.scanSelect(ctx, statement, scan)
+	done(int64(count), err)
 
-	return model.Where(" OR "+field+" IN", strings.Join(model.pendingSelects, ", "))
+	model.cleanup(err)
+	return err
 }
 
-// WhereNotIn adds a WhereNotIn clause
-func (model *SQLQuery) WhereNotIn(field string, values []string) *SQLQuery {
+// scanSelect prepares and runs statement then hands its rows to scan
+func (model *SQLQuery) scanSelect(ctx context.Context, statement *connector.Statement, scan func(columns []string, rows *sql.Rows) (int, error)) (int, error) {
 
-	return model.Where(field+" NOT IN", strings.Join(model.pendingSelects, ", "))
-}
+	rows, err := model.queryRows(ctx, statement, true)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
 
-// OrWhereNotIn adds a OrWhereNotIn clause
-func (model *SQLQuery) OrWhereNotIn(field string, values []string) *SQLQuery {
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
 
-	return model.Where(" OR "+field+" NOT IN", strings.Join(model.pendingSelects, ", "))
+	count, err := scan(columns, rows)
+	if err != nil {
+		return count, err
+	}
+	return count, rows.Err()
 }
 
-// Like adds a Like clause
-func (model *SQLQuery) Like(field string, value string) *SQLQuery {
+// AsRows returns the columns and the rows matching the ongoing select,
+//values in column order.
+//It needs no return type, text columns are returned as strings
+func (model *SQLQuery) AsRows() ([]string, [][]interface{}, error) {
 
-	return model.Where(field+" LIKE", value)
-}
+	var columns []string
+	rows := [][]interface{}{}
 
-// NotLike adds a NotLike clause
-func (model *SQLQuery) NotLike(field string, value string) *SQLQuery {
+	err := model.runSelect(func(resultColumns []string, result *sql.Rows) (int, error) {
+		columns = resultColumns
+		for result.Next() {
+			row, err := scanValues(result, len(columns))
+			if err != nil {
+				return len(rows), err
+			}
+			rows = append(rows, row)
+		}
+		return len(rows), nil
+	})
 
-	return model.Where(field+" NOT LIKE", value)
+	return columns, rows, err
 }
 
-// OrLike adds a OrLike clause
-func (model *SQLQuery) OrLike(field string, value string) *SQLQuery {
+// AsMap returns the rows matching the ongoing select as maps indexed by
+//column name.
+//It needs no return type, text columns are returned as strings
+func (model *SQLQuery) AsMap() ([]map[string]interface{}, error) {
 
-	return model.Where(" OR "+field+" LIKE", value)
-}
+	maps := []map[string]interface{}{}
 
-// OrNotLike adds a OrNotLike clause
-func (model *SQLQuery) OrNotLike(field string, value string) *SQLQuery {
+	err := model.runSelect(func(columns []string, result *sql.Rows) (int, error) {
+		for result.Next() {
+			row, err := scanValues(result, len(columns))
+			if err != nil {
+				return len(maps), err
+			}
 
-	return model.Where(" OR "+field+" NOT LIKE", value)
+			m := make(map[string]interface{}, len(columns))
+			for index := 0; index < len(columns); index++ {
+				m[columns[index]] = row[index]
+			}
+			maps = append(maps, m)
+		}
+		return len(maps), nil
+	})
+
+	return maps, err
 }
 
-// GroupBy adds a GroupBy clause
-func (model *SQLQuery) GroupBy(fields string) *SQLQuery {
+// scanValues scans the current row of n columns as driver values
+func scanValues(rows *sql.Rows, n int) ([]interface{}, error) {
 
-	model.pendingGroupBy = append(model.pendingGroupBy, fields)
-	return model
-}
+	values := make([]interface{}, n)
+	scanArgs := make([]interface{}, n)
+	for index := range values {
+		scanArgs[index] = &values[index]
+	}
 
-// OrderBy adds a OrderBy clause
-func (model *SQLQuery) OrderBy(fields string, order string) *SQLQuery {
+	if err := rows.Scan(scanArgs...); err != nil {
+		return nil, err
+	}
 
-	model.pendingOrderBy = append(model.pendingOrderBy, fields+" "+order)
-	return model
+	for index := range values {
+		values[index] = stringifyBytes(values[index])
+	}
+	return values, nil
 }
 
-// Having adds a Having clause
-func (model *SQLQuery) Having(field string, cond string) *SQLQuery {
+// Debug logs the pending select clauses to the Logger at debug level.
+//Nothing is printed without a Logger, set one on the model or its
+//connector
+func (model *SQLQuery) Debug() {
 
-	concatAnd := func(field string) string {
-		if len(model.pendingHaving) > 0 && !strings.HasPrefix(field, " OR ") {
-			return " AND " + field
-		}
-		return field
-	}
+	model.logger.Log(model.context(), connector.LevelDebug, "qw: pending query",
+		"selects", strings.Join(model.pendingSelects, ", "),
+		"wheres", strings.Join(model.pendingWheres, " AND "),
+		"joins", strings.Join(model.pendingJoins, " "),
+		"unions", strings.Join(model.pendingUnions, " "),
+		"group by", strings.Join(model.pendingGroupBy, ", "))
+}
 
-	model.pendingHaving = append(model.pendingHaving, concatAnd(field)+" "+cond)
+// Join add a join clause to the ongoing select
+//model.Join("myOtherTable", "mytable.id = myOtherTable.id", "left")
+//will produce left join myOtherTable on mytable.id = myOtherTable.id
+func (model *SQLQuery) Join(table string, condition string, joinType string) *SQLQuery {
+	model.pendingJoins = append(model.pendingJoins, joinType+" JOIN "+" "+table+" ON "+condition)
 	return model
 }
 
-// OrHaving adds a OrHaving clause
-func (model *SQLQuery) OrHaving(field string, cond string) *SQLQuery {
-	return model.Having(" OR "+field, cond)
+// With adds the common table expression name AS (sub) to the ongoing select.
+//The values bound by sub are merged, in order, before the ones of the model
+//model.With("recent", model.Subquery("bugs").Where("created_on >", "2017-01-01")).
+//	From("recent")
+//will produce WITH recent AS (SELECT * FROM bugs WHERE ...) SELECT * FROM recent
+func (model *SQLQuery) With(name string, sub *SQLQuery) *SQLQuery {
+	model.pendingWiths = append(model.pendingWiths, name+" AS ("+sub.composeSelectString()+")")
+	model.pendingWithArgs = append(model.pendingWithArgs, sub.selectArgs()...)
+	return model
 }
 
-// Limit adds a Limit clause
-func (model *SQLQuery) Limit(limit int) *SQLQuery {
-	model.limit = limit
+// WithRecursive adds the recursive common table expression
+//name AS (anchor UNION ALL recursive) to the ongoing select.
+//recursive usually joins on name to walk a hierarchy
+//model.WithRecursive("tree",
+//	model.Subquery("categories").Where("parent_id", "0"),
+//	model.Subquery("categories").Select("categories.*").Join("tree", "categories.parent_id = tree.id", ""),
+//).From("tree")
+func (model *SQLQuery) WithRecursive(name string, anchor *SQLQuery, recursive *SQLQuery) *SQLQuery {
+	model.pendingWiths = append(model.pendingWiths,
+		name+" AS ("+anchor.composeSelectString()+" UNION ALL "+recursive.composeSelectString()+")")
+	model.pendingWithArgs = append(model.pendingWithArgs, anchor.selectArgs()...)
+	model.pendingWithArgs = append(model.pendingWithArgs, recursive.selectArgs()...)
+	model.recursiveWith = true
 	return model
 }
 
-// Offset adds a Offset clause
-func (model *SQLQuery) Offset(offset int) *SQLQuery {
-	model.offset = offset
+// From makes the ongoing select read from table, a CTE for instance,
+//instead of the model table
+func (model *SQLQuery) From(table string) *SQLQuery {
+	model.pendingFrom = table
 	return model
 }
 
-// LastQuery returns the last sql query executed
-func (model *SQLQuery) LastQuery() string {
-	return model.lastQuery
+// LockForUpdate locks the selected rows for writing until the end of
+//the transaction (SELECT ... FOR UPDATE)
+func (model *SQLQuery) LockForUpdate() *SQLQuery {
+	model.pendingLock = "FOR UPDATE"
+	return model
 }
 
-// Where adds a Where clause
-func (model *SQLQuery) Where(field string, value string) *SQLQuery {
+// SharedLock locks the selected rows against writes until the end of
+//the transaction (SELECT ... FOR SHARE)
+func (model *SQLQuery) SharedLock() *SQLQuery {
+	model.pendingLock = "FOR SHARE"
+	return model
+}
+
+// SkipLocked makes the row lock skip the rows already locked by
+//others instead of waiting, which is what work queues want
+func (model *SQLQuery) SkipLocked() *SQLQuery {
+	model.pendingLockModifier = "SKIP LOCKED"
+	return model
+}
+
+// NoWait makes the row lock fail at once instead of waiting for the
+//rows locked by others
+func (model *SQLQuery) NoWait() *SQLQuery {
+	model.pendingLockModifier = "NOWAIT"
+	return model
+}
+
+// lockClause renders the pending row lock for the model dialect
+func (model *SQLQuery) lockClause() string {
+	if model.pendingLock == "" {
+		return ""
+	}
+
+	lock := model.pendingLock
+	if model.dialect == MySQL && lock == "FOR SHARE" && model.pendingLockModifier == "" {
+		//Understood by MySQL 5.x too
+		lock = "LOCK IN SHARE MODE"
+	}
+
+	if model.pendingLockModifier != "" {
+		lock += " " + model.pendingLockModifier
+	}
+	return lock
+}
+
+// checkPending reports whether the pending row lock can be used, or the
+//error met while building the pending query
+func (model *SQLQuery) checkPending() error {
+	if model.pendingError != nil {
+		return model.pendingError
+	}
+	if model.pendingLock == "" {
+		if model.pendingLockModifier != "" {
+			return ErrLockModifierWithoutLock
+		}
+		return nil
+	}
+	if model.dialect == SQLite {
+		return ErrLockUnsupported
+	}
+	if model.tx == nil {
+		return ErrLockOutsideTransaction
+	}
+	if model.dialect == Postgres && model.aggregates() {
+		return ErrLockAggregate
+	}
+	return nil
+}
+
+// aggregates reports whether the pending select groups its rows
+func (model *SQLQuery) aggregates() bool {
+	if len(model.pendingGroupBy) > 0 {
+		return true
+	}
+	for i := 0; i < len(model.pendingSelects); i++ {
+		if aggregated.MatchString(model.pendingSelects[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// rebind numbers the ? placeholders of query $1, $2... as Postgres
+//wants, leaving the quoted strings and identifiers untouched
+func rebind(query string) string {
+	var rebound strings.Builder
+	position := 0
+	var quote byte
+	for index := 0; index < len(query); index++ {
+		c := query[index]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '?':
+			position++
+			rebound.WriteString("$" + strconv.Itoa(position))
+			continue
+		}
+		rebound.WriteByte(c)
+	}
+	return rebound.String()
+}
+
+// Union adds a union clause
+func (model *SQLQuery) Union(selectString string) *SQLQuery {
+	model.pendingUnions = append(model.pendingUnions, selectString)
+	return model
+}
+
+// OrWhere adds a OrWhere clause
+func (model *SQLQuery) OrWhere(field string, value string) *SQLQuery {
+	return model.Where(" OR "+field, value)
+}
+
+// WhereIn adds a WhereIn clause
+func (model *SQLQuery) WhereIn(field string, values []string) *SQLQuery {
+
+	return model.Where(field+" IN", strings.Join(model.pendingSelects, ", "))
+}
+
+// OrWhereIn adds a OrWhereIn clause
+func (model *SQLQuery) OrWhereIn(field string, values []string) *SQLQuery {
+
+	return model.Where(" OR "+field+" IN", strings.Join(model.pendingSelects, ", "))
+}
+
+// WhereNotIn adds a WhereNotIn clause
+func (model *SQLQuery) WhereNotIn(field string, values []string) *SQLQuery {
+
+	return model.Where(field+" NOT IN", strings.Join(model.pendingSelects, ", "))
+}
+
+// OrWhereNotIn adds a OrWhereNotIn clause
+func (model *SQLQuery) OrWhereNotIn(field string, values []string) *SQLQuery {
+
+	return model.Where(" OR "+field+" NOT IN", strings.Join(model.pendingSelects, ", "))
+}
+
+// Like adds a Like clause
+func (model *SQLQuery) Like(field string, value string) *SQLQuery {
+
+	return model.Where(field+" LIKE", value)
+}
+
+// NotLike adds a NotLike clause
+func (model *SQLQuery) NotLike(field string, value string) *SQLQuery {
+
+	return model.Where(field+" NOT LIKE", value)
+}
+
+// OrLike adds a OrLike clause
+func (model *SQLQuery) OrLike(field string, value string) *SQLQuery {
+
+	return model.Where(" OR "+field+" LIKE", value)
+}
+
+// OrNotLike adds a OrNotLike clause
+func (model *SQLQuery) OrNotLike(field string, value string) *SQLQuery {
+
+	return model.Where(" OR "+field+" NOT LIKE", value)
+}
+
+// GroupBy adds a GroupBy clause
+func (model *SQLQuery) GroupBy(fields string) *SQLQuery {
+
+	model.pendingGroupBy = append(model.pendingGroupBy, fields)
+	return model
+}
+
+// OrderBy adds a OrderBy clause
+func (model *SQLQuery) OrderBy(fields string, order string) *SQLQuery {
+
+	model.pendingOrderBy = append(model.pendingOrderBy, fields+" "+order)
+	return model
+}
+
+// Having adds a Having clause
+func (model *SQLQuery) Having(field string, cond string) *SQLQuery {
 
 	concatAnd := func(field string) string {
-		if len(model.pendingWheres) > 0 && !strings.HasPrefix(field, " OR ") {
+		if len(model.pendingHaving) > 0 && !strings.HasPrefix(field, " OR ") {
 			return " AND " + field
 		}
 		return field
 	}
 
+	model.pendingHaving = append(model.pendingHaving, concatAnd(field)+" "+cond)
+	return model
+}
+
+// OrHaving adds a OrHaving clause
+func (model *SQLQuery) OrHaving(field string, cond string) *SQLQuery {
+	return model.Having(" OR "+field, cond)
+}
+
+// Limit adds a Limit clause
+func (model *SQLQuery) Limit(limit int) *SQLQuery {
+	model.limit = limit
+	return model
+}
+
+// Offset adds a Offset clause
+func (model *SQLQuery) Offset(offset int) *SQLQuery {
+	model.offset = offset
+	return model
+}
+
+// LastQuery returns the last sql query executed
+func (model *SQLQuery) LastQuery() string {
+	return model.lastQuery
+}
+
+// Where adds a Where clause.
+//value is written in the query as a literal, quoted unless it reads as
+//a number or a boolean: it is neither bound nor converted. WhereValue
+//binds it, through the registered Converters
+func (model *SQLQuery) Where(field string, value string) *SQLQuery {
+
 	stringifyValue := func(value string) string {
 		if _, err := strconv.Atoi(value); err == nil {
 			return value
@@ -489,26 +1153,101 @@ func (model *SQLQuery) Where(field string, value string) *SQLQuery {
 		return "'" + value + "'"
 	}
 
-	hasSpecialSuffix := false
-	specialSuffixes := []string{">=", ">", " <=", " <", " !=", " <>", " NOT LIKE", " LIKE", " NOT IN", " IN"}
+	if hasOperator(field) {
+		model.pendingWheres = append(model.pendingWheres, model.concatAnd(field)+" "+stringifyValue(value))
+	} else {
+		model.pendingWheres = append(model.pendingWheres, model.concatAnd(field)+" = "+stringifyValue(value))
+	}
 
-	for i := 0; i < len(specialSuffixes); i++ {
-		if strings.HasSuffix(field, specialSuffixes[i]) {
+	return model
+}
 
-			hasSpecialSuffix = true
-			break
-		}
+// WhereValue adds a Where clause binding value as a parameter instead of
+//writing it in the query. value can be of any type, registered
+//Converters and driver.Valuer apply
+//	model.WhereValue("created_on >", time.Now().AddDate(0, -1, 0))
+func (model *SQLQuery) WhereValue(field string, value interface{}) *SQLQuery {
+
+	if hasOperator(field) {
+		return model.whereBound(field+" ?", value)
 	}
+	return model.whereBound(field+" = ?", value)
+}
 
-	if hasSpecialSuffix {
-		model.pendingWheres = append(model.pendingWheres, concatAnd(field)+" "+stringifyValue(value))
-	} else {
-		model.pendingWheres = append(model.pendingWheres, concatAnd(field)+" = "+stringifyValue(value))
+// whereBound adds the Where clause condition whose placeholder is
+//bound to value
+func (model *SQLQuery) whereBound(condition string, value interface{}) *SQLQuery {
+
+	converted, err := toDB(value, nil)
+	if err != nil {
+		model.pendingError = err
 	}
 
+	model.pendingWheres = append(model.pendingWheres, model.concatAnd(condition))
+	model.pendingArgs = append(model.pendingArgs, converted)
+
 	return model
 }
 
+// WhereJSON adds a Where clause on a value inside a JSON column.
+//path is the column followed by the keys leading to the value, op a
+//comparison operator and value is bound as a parameter
+//	model.WhereJSON("payload.user.name", "=", "bob")
+//will produce JSON_UNQUOTE(JSON_EXTRACT(payload, '$.user.name')) = ? on MySQL
+//and payload->'user'->>'name' = ? on Postgres
+func (model *SQLQuery) WhereJSON(path string, op string, value interface{}) *SQLQuery {
+	return model.whereBound(model.jsonExtract(path)+" "+op+" ?", value)
+}
+
+// jsonExtract renders the extraction of the JSON value at path,
+//column.key.subkey, as text for the model dialect
+func (model *SQLQuery) jsonExtract(path string) string {
+
+	keys := strings.Split(path, ".")
+	column := keys[0]
+	keys = keys[1:]
+	for index := range keys {
+		keys[index] = strings.Replace(keys[index], "'", "''", -1)
+	}
+
+	switch model.dialect {
+	case Postgres:
+		if len(keys) == 0 {
+			return column + "::text"
+		}
+		extract := column
+		for index := 0; index < len(keys)-1; index++ {
+			extract += "->'" + keys[index] + "'"
+		}
+		return extract + "->>'" + keys[len(keys)-1] + "'"
+	case SQLite:
+		return "json_extract(" + column + ", '" + strings.Join(append([]string{"$"}, keys...), ".") + "')"
+	}
+
+	return "JSON_UNQUOTE(JSON_EXTRACT(" + column + ", '" + strings.Join(append([]string{"$"}, keys...), ".") + "'))"
+}
+
+// concatAnd prefixes field with AND unless it is the first clause or
+//an OR one
+func (model *SQLQuery) concatAnd(field string) string {
+	if len(model.pendingWheres) > 0 && !strings.HasPrefix(field, " OR ") {
+		return " AND " + field
+	}
+	return field
+}
+
+// hasOperator returns whether field ends with a comparison operator
+func hasOperator(field string) bool {
+	specialSuffixes := []string{">=", ">", " <=", " <", " !=", " <>", " NOT LIKE", " LIKE", " NOT IN", " IN"}
+
+	for i := 0; i < len(specialSuffixes); i++ {
+		if strings.HasSuffix(field, specialSuffixes[i]) {
+			return true
+		}
+	}
+	return false
+}
+
 // Select adds a field to the select
 func (model *SQLQuery) Select(selectString string) *SQLQuery {
 
@@ -516,41 +1255,154 @@ func (model *SQLQuery) Select(selectString string) *SQLQuery {
 	return model
 }
 
-// SelectMax adds a SelectMax field to the select
-func (model *SQLQuery) SelectMax(selectString string) *SQLQuery {
+// SelectMax adds a SelectMax field to the select.
+//An optional alias names the column so it can be mapped on a `db` tag
+func (model *SQLQuery) SelectMax(selectString string, alias ...string) *SQLQuery {
 
-	return model.Select("MAX(" + selectString + ")")
+	return model.Select(aliased("MAX("+selectString+")", alias))
 }
 
-// SelectMin adds a SelectMin field to the select
-func (model *SQLQuery) SelectMin(selectString string) *SQLQuery {
+// SelectMin adds a SelectMin field to the select.
+//An optional alias names the column so it can be mapped on a `db` tag
+func (model *SQLQuery) SelectMin(selectString string, alias ...string) *SQLQuery {
 
-	return model.Select("MIN(" + selectString + ")")
+	return model.Select(aliased("MIN("+selectString+")", alias))
 }
 
-// SelectAvg adds a SelectAvg field to the select
-func (model *SQLQuery) SelectAvg(selectString string) *SQLQuery {
+// SelectAvg adds a SelectAvg field to the select.
+//An optional alias names the column so it can be mapped on a `db` tag
+func (model *SQLQuery) SelectAvg(selectString string, alias ...string) *SQLQuery {
 
-	return model.Select("AVG(" + selectString + ")")
+	return model.Select(aliased("AVG("+selectString+")", alias))
 }
 
-// SelectSum adds a SelectSum field to the select
-func (model *SQLQuery) SelectSum(selectString string) *SQLQuery {
+// SelectSum adds a SelectSum field to the select.
+//An optional alias names the column so it can be mapped on a `db` tag
+func (model *SQLQuery) SelectSum(selectString string, alias ...string) *SQLQuery {
 
-	return model.Select("Sum(" + selectString + ")")
+	return model.Select(aliased("Sum("+selectString+")", alias))
 }
 
-// Find returns the first row with key=id in a struct of ReturnType type
-func (model *SQLQuery) Find(id string) (interface{}, error) {
+// aliased appends AS alias to selectString when an alias is given
+func aliased(selectString string, alias []string) string {
+	if len(alias) > 0 && alias[0] != "" {
+		return selectString + " AS " + alias[0]
+	}
+	return selectString
+}
+
+// SelectWindow adds the window function fn to the select.
+//partitionBy, orderBy and alias may be left empty.
+//model.SelectWindow("RANK()", "project", "severity DESC", "position")
+//will produce RANK() OVER (PARTITION BY project ORDER BY severity DESC) AS position
+//which is mapped back on the field tagged `db:"position"`
+func (model *SQLQuery) SelectWindow(fn string, partitionBy string, orderBy string, alias string) *SQLQuery {
+
+	window := []string{}
+	if partitionBy != "" {
+		window = append(window, "PARTITION BY "+partitionBy)
+	}
+	if orderBy != "" {
+		window = append(window, "ORDER BY "+orderBy)
+	}
+
+	return model.Select(aliased(fn+" OVER ("+strings.Join(window, " ")+")", []string{alias}))
+}
+
+// SelectRowNumber adds a ROW_NUMBER() window to the select
+func (model *SQLQuery) SelectRowNumber(partitionBy string, orderBy string, alias string) *SQLQuery {
+
+	return model.SelectWindow("ROW_NUMBER()", partitionBy, orderBy, alias)
+}
+
+// SelectRank adds a RANK() window to the select
+func (model *SQLQuery) SelectRank(partitionBy string, orderBy string, alias string) *SQLQuery {
+
+	return model.SelectWindow("RANK()", partitionBy, orderBy, alias)
+}
+
+// SelectDenseRank adds a DENSE_RANK() window to the select
+func (model *SQLQuery) SelectDenseRank(partitionBy string, orderBy string, alias string) *SQLQuery {
+
+	return model.SelectWindow("DENSE_RANK()", partitionBy, orderBy, alias)
+}
+
+// SelectLag adds a LAG(field, offset) window to the select
+func (model *SQLQuery) SelectLag(field string, offset int, partitionBy string, orderBy string, alias string) *SQLQuery {
+
+	return model.SelectWindow("LAG("+field+", "+strconv.Itoa(offset)+")", partitionBy, orderBy, alias)
+}
+
+// SelectLead adds a LEAD(field, offset) window to the select
+func (model *SQLQuery) SelectLead(field string, offset int, partitionBy string, orderBy string, alias string) *SQLQuery {
+
+	return model.SelectWindow("LEAD("+field+", "+strconv.Itoa(offset)+")", partitionBy, orderBy, alias)
+}
+
+// SelectRunningSum adds a running SUM(field) window to the select
+func (model *SQLQuery) SelectRunningSum(field string, partitionBy string, orderBy string, alias string) *SQLQuery {
+
+	return model.SelectWindow("SUM("+field+")", partitionBy, orderBy, alias)
+}
+
+// Find returns the first row with key=id in a struct of ReturnType type.
+//The key columns are the pk tagged fields of the return type, the model
+//keys when it has none.
+//The key can be of any type; composite keys take one value per column,
+//either as several arguments or as a single []interface{}
+//	model.Key("project", "number").Find("qw", 42)
+func (model *SQLQuery) Find(key ...interface{}) (interface{}, error) {
+
+	if len(key) == 1 {
+		if tuple, ok := key[0].([]interface{}); ok {
+			key = tuple
+		}
+	}
+	columns := model.keyColumns()
+	if len(key) != len(columns) {
+		err := fmt.Errorf("qw: Find expects %d key values, got %d", len(columns), len(key))
+		model.cleanup(err)
+		return nil, err
+	}
+
+	for index := 0; index < len(key); index++ {
+		model.WhereValue(columns[index], key[index])
+	}
 
 	err := model.
 		Limit(1).
-		Where(model.key, id).
 		executeSelectQuery()
 
+	if err == nil && len(model.result) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	if err != nil {
+		return nil, err
+	}
+
 	return model.result[0], err
 }
 
+//keyColumns returns the primary key columns of the return type, the
+//model keys when it has none
+func (model *SQLQuery) keyColumns() []string {
+	if model.returnType == nil {
+		return model.keys
+	}
+
+	fields := model.metaOf(reflect.TypeOf(model.returnType).Elem()).fields
+	keys, _ := model.primaryKey(fields)
+	if len(keys) == 0 {
+		return model.keys
+	}
+
+	columns := make([]string, len(keys))
+	for index := 0; index < len(keys); index++ {
+		columns[index] = fields[keys[index]].column
+	}
+	return columns
+}
+
 // FindAll returns all the row matching the query in an array of ReturnType type
 func (model *SQLQuery) FindAll() ([]interface{}, error) {
 
@@ -582,14 +1434,314 @@ func (model *SQLQuery) FindBy(field string, value string) (interface{}, error) {
 // CountAll returns the number of rows in the table
 func (model *SQLQuery) CountAll() (int, error) {
 
-	e := ""
-	model.pendingSelects = []string{}
+	count := 0
+	err := model.scalar(" count(1) ", &count)
+
+	return count, err
+}
+
+// Sum returns SUM(field) over the rows matching the ongoing select.
+//It isn't Valid when no row matches or all the values are NULL
+func (model *SQLQuery) Sum(field string) (sql.NullFloat64, error) {
+
+	var sum sql.NullFloat64
+	err := model.scalar("SUM("+field+")", &sum)
+
+	return sum, err
+}
+
+// Avg returns AVG(field) over the rows matching the ongoing select.
+//It isn't Valid when no row matches or all the values are NULL
+func (model *SQLQuery) Avg(field string) (sql.NullFloat64, error) {
+
+	var avg sql.NullFloat64
+	err := model.scalar("AVG("+field+")", &avg)
+
+	return avg, err
+}
+
+// Min returns MIN(field) over the rows matching the ongoing select as
+//the driver gives it, so dates and strings work as well as numbers.
+//It is nil when no row matches or all the values are NULL
+func (model *SQLQuery) Min(field string) (interface{}, error) {
+
+	var min interface{}
+	err := model.scalar("MIN("+field+")", &min)
+
+	return stringifyBytes(min), err
+}
+
+// Max returns MAX(field) over the rows matching the ongoing select as
+//the driver gives it, so dates and strings work as well as numbers.
+//It is nil when no row matches or all the values are NULL
+func (model *SQLQuery) Max(field string) (interface{}, error) {
+
+	var max interface{}
+	err := model.scalar("MAX("+field+")", &max)
+
+	return stringifyBytes(max), err
+}
+
+// Value returns field of the first row matching the ongoing select.
+//It returns sql.ErrNoRows if nothing matches
+func (model *SQLQuery) Value(field string) (interface{}, error) {
+
+	var value interface{}
+	err := model.
+		Limit(1).
+		scalar(field, &value)
+
+	return stringifyBytes(value), err
+}
+
+// Pluck returns field for every row matching the ongoing select
+func (model *SQLQuery) Pluck(field string) ([]interface{}, error) {
+
+	values := []interface{}{}
+	model.pendingSelects = []string{field}
+	if err := model.checkPending(); err != nil {
+		model.cleanup(err)
+		return values, err
+	}
+
+	statement := model.selectStatement()
+	ctx, done := model.track(statement)
+
+	rows, err := model.queryRows(ctx, statement, false)
+	if err == nil {
+		for err == nil && rows.Next() {
+			var value interface{}
+			if err = rows.Scan(&value); err == nil {
+				values = append(values, stringifyBytes(value))
+			}
+		}
+		if err == nil {
+			err = rows.Err()
+		}
+		rows.Close()
+	}
+
+	done(int64(len(values)), err)
+	model.cleanup(err)
+	return values, err
+}
+
+// Exists returns whether at least one row matches the ongoing select
+func (model *SQLQuery) Exists() (bool, error) {
+
+	one := 0
 	err := model.
-		Select(" count(1) ").
-		db.QueryRow(model.composeSelectString()).Scan(&e)
+		Limit(1).
+		scalar("1", &one)
+
+	if err == sql.ErrNoRows {
+		model.lastError = nil
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// scalar runs the ongoing select with selectString as sole column and
+//scans the first row in dest.
+//Pending wheres, joins and the like are honoured then cleaned up
+func (model *SQLQuery) scalar(selectString string, dest interface{}) error {
+
+	model.pendingSelects = []string{selectString}
+	if err := model.checkPending(); err != nil {
+		model.cleanup(err)
+		return err
+	}
+
+	statement := model.selectStatement()
+	ctx, done := model.track(statement)
+	count := 0
+
+	rows, err := model.queryRows(ctx, statement, false)
+	if err == nil {
+		if rows.Next() {
+			count = 1
+			err = rows.Scan(dest)
+		} else if err = rows.Err(); err == nil {
+			err = sql.ErrNoRows
+		}
+		rows.Close()
+	}
+
+	done(int64(count), err)
+	model.cleanup(err)
+	return err
+}
+
+// selectStatement returns the ongoing select as a statement
+func (model *SQLQuery) selectStatement() *connector.Statement {
+	return &connector.Statement{
+		Operation: string(OpFind),
+		Table:     model.selectTable(),
+		SQL:       model.composeSelectString(),
+		Args:      model.selectArgs(),
+	}
+}
+
+// queryRows runs a select through the connection middlewares.
+//Finds prepare it first, the prepared statement being released along
+//with the rows
+func (model *SQLQuery) queryRows(ctx context.Context, statement *connector.Statement, prepared bool) (*sql.Rows, error) {
+
+	var rows *sql.Rows
+	model.lastQuery = statement.SQL
+
+	err := model.execute(ctx, statement, func(ctx context.Context, statement *connector.Statement) error {
+		if !prepared {
+			var err error
+			rows, err = model.conn().QueryContext(ctx, statement.SQL, statement.Args...)
+			return err
+		}
+
+		stmtOut, err := model.conn().PrepareContext(ctx, statement.SQL)
+		if err != nil {
+			return err
+		}
+		defer stmtOut.Close()
+		rows, err = stmtOut.QueryContext(ctx, statement.Args...)
+		return err
+	})
+	return rows, err
+}
+
+// execStatement runs the write described by event through the
+//connection middlewares
+func (model *SQLQuery) execStatement(event *HookEvent) (sql.Result, error) {
+
+	var result sql.Result
+	statement := eventStatement(event)
+	model.lastQuery = statement.SQL
+	ctx, done := model.track(statement)
+
+	err := model.execute(ctx, statement, func(ctx context.Context, statement *connector.Statement) error {
+		stmtIns, err := model.conn().PrepareContext(ctx, statement.SQL)
+		if err != nil {
+			return err
+		}
+		defer stmtIns.Close()
+		result, err = stmtIns.ExecContext(ctx, statement.Args...)
+		return err
+	})
+
+	var affectedRows int64
+	if err == nil {
+		affectedRows, _ = result.RowsAffected()
+	}
+	done(affectedRows, err)
+	return result, err
+}
+
+// execReturning runs the write described by event through the
+//connection middlewares, scanning into dest the row its RETURNING
+//clause yields
+func (model *SQLQuery) execReturning(event *HookEvent, dest interface{}) error {
+
+	statement := eventStatement(event)
+	model.lastQuery = statement.SQL
+	ctx, done := model.track(statement)
+
+	err := model.execute(ctx, statement, func(ctx context.Context, statement *connector.Statement) error {
+		stmtIns, err := model.conn().PrepareContext(ctx, statement.SQL)
+		if err != nil {
+			return err
+		}
+		defer stmtIns.Close()
+		return stmtIns.QueryRowContext(ctx, statement.Args...).Scan(dest)
+	})
+
+	var affectedRows int64
+	if err == nil {
+		affectedRows = 1
+	}
+	done(affectedRows, err)
+	return err
+}
+
+// eventStatement returns the statement of the write described by event
+func eventStatement(event *HookEvent) *connector.Statement {
+	return &connector.Statement{
+		Operation: string(event.Operation),
+		Table:     event.Table,
+		SQL:       event.SQL,
+		Args:      event.Args,
+	}
+}
+
+// track starts timing and tracing statement and returns the context
+//to run it with. The returned func reports how it went once its rows
+//are read
+func (model *SQLQuery) track(statement *connector.Statement) (context.Context, func(rows int64, err error)) {
+	ctx, span := model.startSpan(model.statementContext(), statement)
+	written := *statement
+	written.Args = append([]interface{}{}, statement.Args...)
+	start := time.Now()
+	return ctx, func(rows int64, err error) {
+		duration := time.Since(start)
+		endSpan(span, statement, rows, err)
+		if model.collector != nil {
+			model.collector.Observe(statement.Table, statement.Operation, rows, duration, err)
+		}
+		model.logStatement(statement, duration, rows, err)
+		model.reportSlow(statement, &written, duration)
+	}
+}
+
+// reportedArgs returns args as logs and reports may show them,
+//redacted if asked to
+func (model *SQLQuery) reportedArgs(args []interface{}) []interface{} {
+	if !model.redactArgs {
+		return args
+	}
+	redacted := make([]interface{}, len(args))
+	for index := 0; index < len(redacted); index++ {
+		redacted[index] = "[redacted]"
+	}
+	return redacted
+}
 
-	returnValue, _ := strconv.Atoi(e)
-	return returnValue, err
+// logStatement logs a statement at debug level, or at error level if
+//it failed
+func (model *SQLQuery) logStatement(statement *connector.Statement, duration time.Duration, rows int64, err error) {
+
+	keyvals := []interface{}{
+		"operation", statement.Operation,
+		"table", statement.Table,
+		"sql", statement.SQL,
+		"args", model.reportedArgs(statement.Args),
+		"duration", duration,
+		"rows", rows,
+	}
+	if err != nil {
+		model.logger.Log(model.context(), connector.LevelError, "qw: statement failed", append(keyvals, "error", err)...)
+		return
+	}
+	model.logger.Log(model.context(), connector.LevelDebug, "qw: statement", keyvals...)
+}
+
+// execute runs statement with exec wrapped in the connection
+//middlewares. The last query is the statement as it finally ran
+func (model *SQLQuery) execute(ctx context.Context, statement *connector.Statement, exec connector.Exec) error {
+	return connector.Chain(model.middlewares, func(ctx context.Context, statement *connector.Statement) error {
+		if model.dialect == Postgres {
+			statement.SQL = rebind(statement.SQL)
+		}
+		model.lastQuery = statement.SQL
+		return exec(ctx, statement)
+	})(ctx, statement)
+}
+
+// stringifyBytes turns the []byte drivers return for text columns into
+//a string, leaving other values untouched
+func stringifyBytes(value interface{}) interface{} {
+	if b, ok := value.([]byte); ok {
+		return string(b)
+	}
+	return value
 }
 
 // CountBy returns the number of rows in the table with field = value
@@ -613,156 +1765,258 @@ func (model *SQLQuery) IsUnique(field string, value string) (bool, error) {
 	return false, err
 }
 
-// Insert insert a struct to the db
+// Insert insert a struct to the db.
+//Readonly and auto-incremented fields are not written, neither are
+//omitempty and default ones holding their zero value
 func (model *SQLQuery) Insert(data interface{}) (bool, error) {
+	return model.write(OpInsert, data, model.executebeforeInsert, model.executeafterInsert, model.insert)
+}
 
-	model.result = []interface{}{data}
-	model.executebeforeInsert()
+//insert writes data, see Insert
+func (model *SQLQuery) insert(data interface{}, event *HookEvent) (bool, error) {
 
 	columnString := []string{}
 	var valueString []interface{}
 	placeHolders := []string{}
-	structPKIndex := -1
 
 	s := reflect.ValueOf(data).Elem()
-	typeOfT := s.Type()
-	for i := 0; i < s.NumField(); i++ {
+	meta := model.metaOf(s.Type())
+	if meta.err != nil {
+		return false, meta.err
+	}
+	fields := meta.fields
+	keys, pkAuto := model.primaryKey(fields)
 
-		column, dbTagPresent := typeOfT.Field(i).Tag.Lookup("db")
+	for i := 0; i < len(fields); i++ {
 
-		if dbTagPresent && column != model.key {
-			columnString = append(columnString, column)
-			valueString = append(valueString, s.Field(i).Interface())
-			placeHolders = append(placeHolders, "?")
-		} else if column == model.key {
-			structPKIndex = i
+		if fields[i].generator != "" {
+			if err := generateKey(fieldOf(s, fields[i].index), fields[i].generator); err != nil {
+				return false, err
+			}
 		}
+
+		value := valueOf(s, fields[i].index)
+
+		if fields[i].readonly || fields[i].auto || (pkAuto && i == keys[0]) {
+			continue
+		}
+		if (fields[i].omitempty || fields[i].useDefault) && isZero(value) {
+			continue
+		}
+
+		value, err := toDB(value, fields[i].converter)
+		if err != nil {
+			return false, err
+		}
+
+		columnString = append(columnString, fields[i].column)
+		valueString = append(valueString, value)
+		placeHolders = append(placeHolders, "?")
 	}
 
-	insertStr := "INSERT INTO " + model.tableName +
+	insertStr := "INSERT INTO " + model.table(data) +
 		" (" + strings.Join(columnString, ", ") + ") " +
 		" VALUES (" + strings.Join(placeHolders, ", ") + ")"
 
-	stmtIns, err := model.db.Prepare(insertStr)
+	//Postgres drivers have no LastInsertId, the key is returned instead
+	returning := pkAuto && fields[keys[0]].integer && model.dialect == Postgres
+	if returning {
+		insertStr += " RETURNING " + fields[keys[0]].column
+	}
 
-	model.lastQuery = insertStr
+	event.SQL = insertStr
+	event.Args = valueString
 
-	if err != nil {
-		return false, err
+	if returning {
+		var lastInsertedID int64
+		if err := model.execReturning(event, &lastInsertedID); err != nil {
+			return false, err
+		}
+		event.RowsAffected = 1
+		setInteger(fieldOf(s, fields[keys[0]].index), lastInsertedID)
+		return true, nil
 	}
 
-	result, err := stmtIns.Exec(valueString...)
-	lastInsertedID, err := result.LastInsertId()
-
+	result, err := model.execStatement(event)
 	if err != nil {
 		return false, err
 	}
-
-	if structPKIndex != -1 {
-		s.Field(structPKIndex).SetInt(lastInsertedID)
+	if affectedRows, err := result.RowsAffected(); err == nil {
+		event.RowsAffected = affectedRows
 	}
 
-	model.executeafterInsert()
+	if pkAuto && fields[keys[0]].integer {
+		lastInsertedID, err := result.LastInsertId()
+
+		if err != nil {
+			return false, err
+		}
+
+		setInteger(fieldOf(s, fields[keys[0]].index), lastInsertedID)
+	}
 
 	return true, nil
 }
 
 // Delete deletes a struct from the db based on key
 func (model *SQLQuery) Delete(data interface{}) (bool, error) {
+	return model.write(OpDelete, data, model.executebeforeDelete, model.executeafterDelete, model.delete)
+}
 
-	model.result = []interface{}{data}
-	model.executebeforeDelete()
-
-	structPKIndex := -1
+//delete removes data, see Delete
+func (model *SQLQuery) delete(data interface{}, event *HookEvent) (bool, error) {
 
 	s := reflect.ValueOf(data).Elem()
-	typeOfT := s.Type()
-	for i := 0; i < s.NumField(); i++ {
-
-		column, _ := typeOfT.Field(i).Tag.Lookup("db")
-
-		if column == model.key {
-			structPKIndex = i
-			break
-		}
+	meta := model.metaOf(s.Type())
+	if meta.err != nil {
+		return false, meta.err
+	}
+	fields := meta.fields
+	keys, _ := model.primaryKey(fields)
+	if len(keys) == 0 {
+		return false, ErrNoPrimaryKey
 	}
 
-	pk := s.Field(structPKIndex).Interface().(int)
-
-	deleteStr := "DELETE FROM " + model.tableName +
-		" WHERE " + model.key + " = ?"
-
-	stmtIns, err := model.db.Prepare(deleteStr)
-
-	model.lastQuery = deleteStr
-
+	whereString, pk, err := keyWhere(s, fields, keys)
 	if err != nil {
 		return false, err
 	}
 
-	result, err := stmtIns.Exec(pk)
-	lastInsertedID, err := result.LastInsertId()
+	deleteStr := "DELETE FROM " + model.table(data) +
+		" WHERE " + whereString
+
+	event.SQL = deleteStr
+	event.Args = pk
 
+	result, err := model.execStatement(event)
 	if err != nil {
 		return false, err
 	}
-
-	if structPKIndex != -1 {
-		s.Field(structPKIndex).SetInt(lastInsertedID)
+	if affectedRows, err := result.RowsAffected(); err == nil {
+		event.RowsAffected = affectedRows
 	}
 
 	data = nil
 
-	model.executeafterDelete()
-
 	return true, nil
 
 }
 
-//Update sync the data struct with the db according to its model.key field
+//Update sync the data struct with the db according to its primary key.
+//Readonly fields are not written, neither are omitempty ones holding
+//their zero value.
+//When a version column is configured, the row is only updated if its
+//version still matches the struct one; the version is then incremented
+//on both sides, otherwise ErrStaleObject is returned
 func (model *SQLQuery) Update(data interface{}) (bool, error) {
+	return model.write(OpUpdate, data, model.executebeforeUpdate, model.executeafterUpdate, model.update)
+}
 
-	model.result = []interface{}{data}
-	model.executebeforeUpdate()
+//update writes data, see Update
+func (model *SQLQuery) update(data interface{}, event *HookEvent) (bool, error) {
 
 	columnString := []string{}
 	var valueString []interface{}
-	structPKIndex := -1
 
 	s := reflect.ValueOf(data).Elem()
-	typeOfT := s.Type()
-	for i := 0; i < s.NumField(); i++ {
+	meta := model.metaOf(s.Type())
+	if meta.err != nil {
+		return false, meta.err
+	}
+	fields := meta.fields
+	keys, _ := model.primaryKey(fields)
+	if len(keys) == 0 {
+		return false, ErrNoPrimaryKey
+	}
+	versionIndex, err := model.versionIndex(fields)
+	if err != nil {
+		return false, err
+	}
+	isKey := make(map[int]bool)
+	for index := 0; index < len(keys); index++ {
+		isKey[keys[index]] = true
+	}
 
-		column, dbTagPresent := typeOfT.Field(i).Tag.Lookup("db")
+	for i := 0; i < len(fields); i++ {
 
-		if dbTagPresent && column != model.key {
-			columnString = append(columnString, column+" = ?")
-			valueString = append(valueString, s.Field(i).Interface())
-		} else if column == model.key {
-			structPKIndex = i
+		value := valueOf(s, fields[i].index)
+
+		if isKey[i] || i == versionIndex || fields[i].readonly {
+			continue
+		}
+		if fields[i].omitempty && isZero(value) {
+			continue
 		}
+
+		value, err := toDB(value, fields[i].converter)
+		if err != nil {
+			return false, err
+		}
+
+		columnString = append(columnString, fields[i].column+" = ?")
+		valueString = append(valueString, value)
 	}
 
-	insertStr := "UPDATE " + model.tableName + " SET " +
-		strings.Join(columnString, ", ") +
-		" WHERE " + model.key + " = ?"
+	whereString, pk, err := keyWhere(s, fields, keys)
+	if err != nil {
+		return false, err
+	}
+	whereString = " WHERE " + whereString
+	var version int64
+	if versionIndex != -1 {
+		version = integerOf(fieldOf(s, fields[versionIndex].index))
+		columnString = append(columnString, fields[versionIndex].column+" = ?")
+		valueString = append(valueString, version+1)
+		whereString += " AND " + fields[versionIndex].column + " = ?"
+	}
+
+	insertStr := "UPDATE " + model.table(data) + " SET " +
+		strings.Join(columnString, ", ") + whereString
 
-	stmtIns, err := model.db.Prepare(insertStr)
+	valueString = append(valueString, pk...)
+	if versionIndex != -1 {
+		valueString = append(valueString, version)
+	}
 
-	model.lastQuery = insertStr
+	event.SQL = insertStr
+	event.Args = valueString
 
+	result, err := model.execStatement(event)
 	if err != nil {
 		return false, err
 	}
-
-	result, err := stmtIns.Exec(append(valueString, s.Field(structPKIndex).Interface())...)
 	affectedRows, err := result.RowsAffected()
 
 	if err != nil {
 		return false, err
 	}
+	event.RowsAffected = affectedRows
 
-	model.executeafterUpdate()
+	if versionIndex != -1 {
+		if affectedRows == 0 {
+			return false, ErrStaleObject
+		}
+		setInteger(fieldOf(s, fields[versionIndex].index), version+1)
+	}
 
 	return affectedRows == 1, nil
 }
+
+//integerOf reads an integer field
+func integerOf(field reflect.Value) int64 {
+	switch field.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(field.Uint())
+	}
+	return field.Int()
+}
+
+//setInteger writes an integer field
+func setInteger(field reflect.Value, value int64) {
+	switch field.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		field.SetUint(uint64(value))
+		return
+	}
+	field.SetInt(value)
+}
@@ -1,8 +1,12 @@
 package query
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
+	"regexp"
 	"testing"
+	"time"
 
 	"errors"
 
@@ -124,7 +128,7 @@ func TestReflectResult(t *testing.T) {
 		"mock:mock@mock(127.0.0.1:3306)/mock",
 	}
 
-	values := []sql.RawBytes{
+	values := []driver.Value{
 		[]byte("1"),
 		[]byte("test"),
 		[]byte("1.2"),
@@ -141,11 +145,12 @@ func TestReflectResult(t *testing.T) {
 	m, err := NewSQLQuery("bugs", s, new(CnxMock))
 	m.returnType = new(T)
 
-	reflectedStruct := m.reflectResult(values, columns)
-
 	assert := assert.New(t)
 	assert.Nil(err)
 
+	reflectedStruct, err := scanRow(m, columns, values...)
+	assert.Nil(err)
+
 	assert.Equal(1, reflectedStruct.(T).ID)
 	assert.Equal("test", reflectedStruct.(T).Name)
 	assert.Equal(1.2, reflectedStruct.(T).AnotherFloat)
@@ -190,3 +195,693 @@ func TestReflectResult(t *testing.T) {
 // 	fmt.Println(err)
 
 // }
+
+func TestComposeSelectStringWith(t *testing.T) {
+	s := []string{
+		"mock:mock@mock(127.0.0.1:3306)/mock",
+	}
+	m, err := NewSQLQuery("categories", s, new(CnxMock))
+
+	anchor := m.Subquery("categories").Where("parent_id", "0")
+	recursive := m.Subquery("categories").
+		Select("categories.*").
+		Join("tree", "categories.parent_id = tree.id", "")
+	recent := m.Subquery("bugs").Where("a >", "1")
+
+	selectStr := m.
+		WithRecursive("tree", anchor, recursive).
+		With("recent", recent).
+		From("tree").
+		Join("recent", "recent.a = tree.a", "").
+		composeSelectString()
+
+	assert := assert.New(t)
+	assert.Nil(err)
+	assert.Equal("WITH RECURSIVE tree AS (SELECT  *  FROM categories WHERE parent_id = 0 UNION ALL SELECT categories.* FROM categories JOIN  tree ON categories.parent_id = tree.id), recent AS (SELECT  *  FROM bugs WHERE a > 1) SELECT  *  FROM tree JOIN  recent ON recent.a = tree.a", selectStr)
+
+	m.cleanup(nil)
+	assert.Empty(m.pendingWiths, "should be empty")
+	assert.Empty(m.selectArgs(), "should be empty")
+	assert.Equal("SELECT  *  FROM categories", m.composeSelectString())
+}
+
+func TestWithArgs(t *testing.T) {
+	s := []string{
+		"mock:mock@mock(127.0.0.1:3306)/mock",
+	}
+	cnx := new(CnxMock)
+	m, err := NewSQLQuery("categories", s, cnx)
+
+	type Category struct {
+		ID int `db:"id"`
+	}
+
+	assert := assert.New(t)
+	assert.Nil(err)
+
+	anchor := m.Subquery("categories").WhereValue("parent_id", 0)
+	recursive := m.Subquery("categories").
+		Select("categories.*").
+		Join("tree", "categories.parent_id = tree.id", "").
+		WhereValue("categories.depth <", 5)
+	recent := m.Subquery("bugs").WhereValue("a >", 1)
+
+	cnx.Mock.ExpectPrepare(regexp.QuoteMeta("WITH RECURSIVE tree AS (SELECT  *  FROM categories WHERE parent_id = ? UNION ALL SELECT categories.* FROM categories JOIN  tree ON categories.parent_id = tree.id WHERE categories.depth < ?), recent AS (SELECT  *  FROM bugs WHERE a > ?) SELECT  *  FROM tree JOIN  recent ON recent.a = tree.a WHERE tree.b = ?")).
+		ExpectQuery().
+		WithArgs(0, 5, 1, 4).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+
+	categories, err := m.
+		ReturnType(Category{}).
+		WithRecursive("tree", anchor, recursive).
+		With("recent", recent).
+		From("tree").
+		Join("recent", "recent.a = tree.a", "").
+		WhereValue("tree.b", 4).
+		FindAll()
+	assert.Nil(err)
+	assert.Equal([]interface{}{Category{3}}, categories)
+	assert.Empty(m.selectArgs(), "should be empty")
+
+	assert.Nil(cnx.Mock.ExpectationsWereMet())
+}
+
+func TestSelectWindow(t *testing.T) {
+	s := []string{
+		"mock:mock@mock(127.0.0.1:3306)/mock",
+	}
+	m, err := NewSQLQuery("bugs", s, new(CnxMock))
+
+	selectStr := m.
+		Select("id").
+		SelectRowNumber("project", "created_on", "nth").
+		SelectRank("", "severity DESC", "rnk").
+		SelectDenseRank("project", "", "drnk").
+		SelectLag("severity", 1, "project", "created_on", "prev").
+		SelectLead("severity", 2, "project", "created_on", "next").
+		SelectRunningSum("cost", "project", "created_on", "total").
+		composeSelectString()
+
+	assert := assert.New(t)
+	assert.Nil(err)
+	assert.Equal("SELECT id, ROW_NUMBER() OVER (PARTITION BY project ORDER BY created_on) AS nth, RANK() OVER (ORDER BY severity DESC) AS rnk, DENSE_RANK() OVER (PARTITION BY project) AS drnk, LAG(severity, 1) OVER (PARTITION BY project ORDER BY created_on) AS prev, LEAD(severity, 2) OVER (PARTITION BY project ORDER BY created_on) AS next, SUM(cost) OVER (PARTITION BY project ORDER BY created_on) AS total FROM bugs", selectStr)
+
+	m.cleanup(nil)
+	assert.Equal("SELECT RANK() OVER (ORDER BY severity DESC) FROM bugs", m.SelectWindow("RANK()", "", "severity DESC", "").composeSelectString())
+	m.cleanup(nil)
+
+	type T struct {
+		ID    int     `db:"id"`
+		Nth   int64   `db:"nth"`
+		Rank  uint32  `db:"rnk"`
+		Total float32 `db:"total"`
+	}
+
+	m.returnType = new(T)
+	reflectedStruct, err := scanRow(m, []string{"id", "nth", "rnk", "total"},
+		[]byte("7"), []byte("3"), []byte("2"), []byte("10.5"))
+	assert.Nil(err)
+
+	assert.Equal(T{7, 3, 2, 10.5}, reflectedStruct.(T))
+}
+
+func TestAggregates(t *testing.T) {
+	s := []string{
+		"mock:mock@mock(127.0.0.1:3306)/mock",
+	}
+	cnx := new(CnxMock)
+	m, err := NewSQLQuery("bugs", s, cnx)
+
+	assert := assert.New(t)
+	assert.Nil(err)
+
+	assert.Equal("SELECT MAX(e) AS e_max, AVG(d) FROM bugs", m.SelectMax("e", "e_max").SelectAvg("d").composeSelectString())
+	m.cleanup(nil)
+
+	cnx.Mock.ExpectQuery(regexp.QuoteMeta("SELECT SUM(cost) FROM bugs JOIN  p ON p.id = bugs.p WHERE a = 1")).
+		WillReturnRows(sqlmock.NewRows([]string{"s"}).AddRow(12.5))
+	sum, err := m.Join("p", "p.id = bugs.p", "").Where("a", "1").Sum("cost")
+	assert.Nil(err)
+	assert.Equal(sql.NullFloat64{Float64: 12.5, Valid: true}, sum)
+	assert.Empty(m.pendingWheres, "should be empty")
+
+	cnx.Mock.ExpectQuery(regexp.QuoteMeta("SELECT AVG(cost) FROM bugs")).
+		WillReturnRows(sqlmock.NewRows([]string{"s"}).AddRow(nil))
+	avg, err := m.Avg("cost")
+	assert.Nil(err)
+	assert.False(avg.Valid, "should tell NULL from 0")
+
+	created := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	cnx.Mock.ExpectQuery(regexp.QuoteMeta("SELECT MIN(created_on) FROM bugs")).
+		WillReturnRows(sqlmock.NewRows([]string{"m"}).AddRow(created))
+	cnx.Mock.ExpectQuery(regexp.QuoteMeta("SELECT MAX(name) FROM bugs WHERE a = 4")).
+		WillReturnRows(sqlmock.NewRows([]string{"m"}).AddRow([]byte("zeta")))
+	cnx.Mock.ExpectQuery(regexp.QuoteMeta("SELECT MAX(cost) FROM bugs WHERE a = 5")).
+		WillReturnRows(sqlmock.NewRows([]string{"m"}).AddRow(nil))
+
+	min, err := m.Min("created_on")
+	assert.Nil(err)
+	assert.Equal(created, min)
+	max, err := m.Where("a", "4").Max("name")
+	assert.Nil(err)
+	assert.Equal("zeta", max)
+	max, err = m.Where("a", "5").Max("cost")
+	assert.Nil(err)
+	assert.Nil(max)
+
+	cnx.Mock.ExpectQuery(regexp.QuoteMeta("SELECT  count(1)  FROM bugs WHERE a = 2")).
+		WillReturnRows(sqlmock.NewRows([]string{"c"}).AddRow(3))
+	count, err := m.CountBy("a", "2")
+	assert.Nil(err)
+	assert.Equal(3, count)
+
+	cnx.Mock.ExpectQuery(regexp.QuoteMeta("SELECT name FROM bugs LIMIT 1")).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow([]byte("crash")))
+	value, err := m.Value("name")
+	assert.Nil(err)
+	assert.Equal("crash", value)
+
+	cnx.Mock.ExpectQuery(regexp.QuoteMeta("SELECT id FROM bugs WHERE a > 1")).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+	ids, err := m.Where("a >", "1").Pluck("id")
+	assert.Nil(err)
+	assert.Equal([]interface{}{int64(1), int64(2)}, ids)
+
+	cnx.Mock.ExpectQuery(regexp.QuoteMeta("SELECT 1 FROM bugs WHERE a = 3 LIMIT 1")).
+		WillReturnRows(sqlmock.NewRows([]string{"1"}))
+	exists, err := m.Where("a", "3").Exists()
+	assert.Nil(err)
+	assert.False(exists)
+
+	cnx.Mock.ExpectQuery(regexp.QuoteMeta("SELECT 1 FROM bugs LIMIT 1")).
+		WillReturnRows(sqlmock.NewRows([]string{"1"}).AddRow(1))
+	exists, err = m.Exists()
+	assert.Nil(err)
+	assert.True(exists)
+
+	assert.Nil(cnx.Mock.ExpectationsWereMet())
+}
+
+func TestRowLocks(t *testing.T) {
+	s := []string{
+		"mock:mock@mock(127.0.0.1:3306)/mock",
+	}
+	cnx := new(CnxMock)
+	m, err := NewSQLQuery("jobs", s, cnx)
+
+	type Job struct {
+		ID int `db:"id"`
+	}
+	m.returnType = new(Job)
+
+	assert := assert.New(t)
+	assert.Nil(err)
+
+	_, err = m.Where("state", "todo").LockForUpdate().FindAll()
+	assert.Equal(ErrLockOutsideTransaction, err)
+	assert.Empty(m.pendingWheres, "should be empty")
+
+	_, err = m.SkipLocked().FindAll()
+	assert.Equal(ErrLockModifierWithoutLock, err)
+
+	cnx.Mock.ExpectBegin()
+	cnx.Mock.ExpectPrepare(regexp.QuoteMeta("SELECT  *  FROM jobs WHERE state = 'todo' LIMIT 1 FOR UPDATE SKIP LOCKED")).
+		ExpectQuery().
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+	cnx.Mock.ExpectQuery(regexp.QuoteMeta("SELECT  count(1)  FROM jobs LOCK IN SHARE MODE")).
+		WillReturnRows(sqlmock.NewRows([]string{"c"}).AddRow(1))
+	cnx.Mock.ExpectCommit()
+
+	assert.Nil(m.Begin())
+	assert.Equal(ErrTxOpen, m.Begin())
+	jobs, err := m.Where("state", "todo").Limit(1).LockForUpdate().SkipLocked().FindAll()
+	assert.Nil(err)
+	assert.Equal([]interface{}{Job{4}}, jobs)
+	_, err = m.SharedLock().CountAll()
+	assert.Nil(err)
+	assert.Nil(m.Commit())
+	assert.Equal(sql.ErrTxDone, m.Rollback())
+
+	assert.Equal("SELECT  *  FROM jobs FOR SHARE NOWAIT", m.Dialect(Postgres).SharedLock().NoWait().composeSelectString())
+	m.cleanup(nil)
+
+	_, err = m.Dialect(SQLite).LockForUpdate().FindAll()
+	assert.Equal(ErrLockUnsupported, err)
+
+	assert.Nil(cnx.Mock.ExpectationsWereMet())
+}
+
+func TestPostgresRowLocks(t *testing.T) {
+	s := []string{
+		"mock:mock@mock(127.0.0.1:3306)/mock",
+	}
+	cnx := new(CnxMock)
+	m, err := NewSQLQuery("jobs", s, cnx)
+	m.Dialect(Postgres)
+
+	type Job struct {
+		ID int `db:"id"`
+	}
+	m.returnType = new(Job)
+
+	assert := assert.New(t)
+	assert.Nil(err)
+
+	cnx.Mock.ExpectBegin()
+	cnx.Mock.ExpectRollback()
+	assert.Nil(m.Begin())
+
+	_, err = m.LockForUpdate().CountAll()
+	assert.Equal(ErrLockAggregate, err)
+	_, err = m.Select("state").GroupBy("state").LockForUpdate().FindAll()
+	assert.Equal(ErrLockAggregate, err)
+	_, err = m.SharedLock().Pluck("DISTINCT state")
+	assert.Equal(ErrLockAggregate, err)
+	assert.Empty(m.pendingLock, "should be empty")
+
+	assert.Nil(m.Rollback())
+	assert.Nil(cnx.Mock.ExpectationsWereMet())
+}
+
+func TestPostgresPlaceholders(t *testing.T) {
+	s := []string{
+		"mock:mock@mock(127.0.0.1:3306)/mock",
+	}
+	cnx := new(CnxMock)
+	m, err := NewSQLQuery("jobs", s, cnx)
+	m.Dialect(Postgres)
+
+	type Job struct {
+		ID    int    `db:"id"`
+		State string `db:"state"`
+		Owner string `db:"owner"`
+	}
+
+	assert := assert.New(t)
+	assert.Nil(err)
+
+	assert.Equal("SELECT 'a?' FROM t WHERE a = $1 AND b = $2", rebind("SELECT 'a?' FROM t WHERE a = ? AND b = ?"))
+
+	cnx.Mock.ExpectPrepare(regexp.QuoteMeta("INSERT INTO jobs (state, owner)  VALUES ($1, $2) RETURNING id")).
+		ExpectQuery().
+		WithArgs("todo", "ann").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	cnx.Mock.ExpectPrepare(regexp.QuoteMeta("UPDATE jobs SET state = $1, owner = $2 WHERE id = $3")).
+		ExpectExec().
+		WithArgs("done", "ann", 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	job := &Job{State: "todo", Owner: "ann"}
+	ok, err := m.Insert(job)
+	assert.Nil(err)
+	assert.True(ok)
+	assert.Equal(7, job.ID)
+
+	job.State = "done"
+	ok, err = m.Update(job)
+	assert.Nil(err)
+	assert.True(ok)
+
+	assert.Nil(cnx.Mock.ExpectationsWereMet())
+}
+
+func TestUpdateVersion(t *testing.T) {
+	s := []string{
+		"mock:mock@mock(127.0.0.1:3306)/mock",
+	}
+	cnx := new(CnxMock)
+	m, err := NewSQLQuery("bugs", s, cnx)
+
+	type Bug struct {
+		ID      int    `db:"id"`
+		Name    string `db:"name"`
+		Version int    `db:"version,version"`
+	}
+
+	assert := assert.New(t)
+	assert.Nil(err)
+
+	updateStr := regexp.QuoteMeta("UPDATE bugs SET name = ?, version = ? WHERE id = ? AND version = ?")
+	cnx.Mock.ExpectPrepare(updateStr).
+		ExpectExec().
+		WithArgs("crash", int64(3), 1, int64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	cnx.Mock.ExpectPrepare(updateStr).
+		ExpectExec().
+		WithArgs("crash", int64(4), 1, int64(3)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	b := &Bug{1, "crash", 2}
+	updated, err := m.Update(b)
+	assert.Nil(err)
+	assert.True(updated)
+	assert.Equal(3, b.Version)
+
+	updated, err = m.Update(b)
+	assert.Equal(ErrStaleObject, err)
+	assert.False(updated)
+	assert.Equal(3, b.Version)
+
+	type Untagged struct {
+		ID   int    `db:"id"`
+		Rev  uint   `db:"rev"`
+		Name string `db:"name"`
+	}
+
+	cnx.Mock.ExpectPrepare(regexp.QuoteMeta("UPDATE bugs SET name = ?, rev = ? WHERE id = ? AND rev = ?")).
+		ExpectExec().
+		WithArgs("crash", int64(1), 1, int64(0)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	u := &Untagged{1, 0, "crash"}
+	_, err = m.VersionField("rev").Update(u)
+	assert.Nil(err)
+	assert.Equal(uint(1), u.Rev)
+
+	type Textual struct {
+		ID int    `db:"id"`
+		V  string `db:"v,version"`
+	}
+
+	_, err = m.VersionField("").Update(&Textual{1, "a"})
+	assert.EqualError(err, "qw: a version needs an integer field, not a string on field V")
+	_, err = m.VersionField("name").Update(u)
+	assert.EqualError(err, "qw: version column name isn't an integer")
+
+	assert.Nil(cnx.Mock.ExpectationsWereMet())
+}
+
+func TestTagOptions(t *testing.T) {
+	s := []string{
+		"mock:mock@mock(127.0.0.1:3306)/mock",
+	}
+	cnx := new(CnxMock)
+	m, err := NewSQLQuery("users", s, cnx)
+
+	type User struct {
+		UID       int    `db:"uid,pk,auto"`
+		Name      string `db:"name"`
+		CreatedOn string `db:"created_on,readonly"`
+		Nickname  string `db:"nickname,omitempty"`
+		Status    string `db:"status,default"`
+		Password  string `db:"-"`
+		Ignored   string `db:"-"`
+	}
+
+	assert := assert.New(t)
+	assert.Nil(err)
+
+	cnx.Mock.ExpectPrepare(regexp.QuoteMeta("INSERT INTO users (name)  VALUES (?)")).
+		ExpectExec().
+		WithArgs("bob").
+		WillReturnResult(sqlmock.NewResult(12, 1))
+	cnx.Mock.ExpectPrepare(regexp.QuoteMeta("UPDATE users SET name = ?, nickname = ?, status = ? WHERE uid = ?")).
+		ExpectExec().
+		WithArgs("bob", "b", "", 12).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	u := &User{Name: "bob", CreatedOn: "now", Password: "secret"}
+	_, err = m.Insert(u)
+	assert.Nil(err)
+	assert.Equal(12, u.UID)
+
+	u.Nickname = "b"
+	updated, err := m.Update(u)
+	assert.Nil(err)
+	assert.True(updated)
+
+	m.returnType = new(User)
+	reflectedStruct, err := scanRow(m, []string{"uid", "name", "created_on", "-"},
+		[]byte("3"), []byte("ann"), []byte("yesterday"), []byte("secret"))
+	assert.Nil(err)
+	assert.Equal(User{UID: 3, Name: "ann", CreatedOn: "yesterday"}, reflectedStruct.(User))
+
+	cnx.Mock.ExpectPrepare(regexp.QuoteMeta("SELECT  *  FROM users WHERE uid = ? LIMIT 1")).
+		ExpectQuery().
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"uid", "name"}).AddRow(3, "ann"))
+	cnx.Mock.ExpectPrepare(regexp.QuoteMeta("DELETE FROM users WHERE uid = ?")).
+		ExpectExec().
+		WithArgs(12).
+		WillReturnResult(sqlmock.NewErrorResult(errors.New("no LastInsertId")))
+
+	found, err := m.Find(3)
+	assert.Nil(err)
+	assert.Equal(User{UID: 3, Name: "ann"}, found)
+
+	_, err = m.Delete(u)
+	assert.Nil(err)
+	assert.Equal(12, u.UID)
+
+	type Code struct {
+		Code  string `db:"code,pk"`
+		Label string `db:"label"`
+	}
+
+	cnx.Mock.ExpectPrepare(regexp.QuoteMeta("INSERT INTO users (code, label)  VALUES (?, ?)")).
+		ExpectExec().
+		WithArgs("fr", "France").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	_, err = m.Insert(&Code{"fr", "France"})
+	assert.Nil(err)
+
+	_, err = m.Update(&struct {
+		Name string `db:"name"`
+	}{"bob"})
+	assert.Equal(ErrNoPrimaryKey, err)
+
+	assert.Nil(cnx.Mock.ExpectationsWereMet())
+}
+
+func TestAsMapAndRows(t *testing.T) {
+	s := []string{
+		"mock:mock@mock(127.0.0.1:3306)/mock",
+	}
+	cnx := new(CnxMock)
+	m, err := NewSQLQuery("bugs", s, cnx)
+
+	assert := assert.New(t)
+	assert.Nil(err)
+
+	cnx.Mock.ExpectPrepare(regexp.QuoteMeta("SELECT id, name FROM bugs WHERE a = 1")).
+		ExpectQuery().
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).
+			AddRow(int64(1), []byte("crash")).
+			AddRow(int64(2), nil))
+	cnx.Mock.ExpectPrepare(regexp.QuoteMeta("SELECT  *  FROM bugs")).
+		ExpectQuery().
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).
+			AddRow(int64(1), []byte("crash")))
+
+	maps, err := m.Select("id, name").Where("a", "1").AsMap()
+	assert.Nil(err)
+	assert.Equal([]map[string]interface{}{
+		{"id": int64(1), "name": "crash"},
+		{"id": int64(2), "name": nil},
+	}, maps)
+	assert.Empty(m.pendingWheres, "should be empty")
+
+	columns, rows, err := m.AsRows()
+	assert.Nil(err)
+	assert.Equal([]string{"id", "name"}, columns)
+	assert.Equal([][]interface{}{{int64(1), "crash"}}, rows)
+
+	assert.Nil(cnx.Mock.ExpectationsWereMet())
+}
+
+func TestReturnTypeAndInto(t *testing.T) {
+	s := []string{
+		"mock:mock@mock(127.0.0.1:3306)/mock",
+	}
+	cnx := new(CnxMock)
+	m, err := NewSQLQuery("bugs", s, cnx)
+
+	type Bug struct {
+		ID   int    `db:"id"`
+		Name string `db:"name"`
+	}
+
+	type Count struct {
+		Total int `db:"total"`
+	}
+
+	assert := assert.New(t)
+	assert.Nil(err)
+
+	_, err = m.FindAll()
+	assert.Equal(ErrNoReturnType, err)
+
+	_, err = m.ReturnType(42).FindAll()
+	assert.Equal("qw: return type must be a struct, got int", err.Error())
+
+	_, err = m.ReturnType(struct{ hidden int }{}).FindAll()
+	assert.Equal("qw: return type struct { hidden int } has no field mappable on a column", err.Error())
+
+	bugRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "a").AddRow(2, "b")
+	}
+	cnx.Mock.ExpectPrepare(regexp.QuoteMeta("SELECT  *  FROM bugs")).ExpectQuery().WillReturnRows(bugRows())
+	cnx.Mock.ExpectPrepare(regexp.QuoteMeta("SELECT  *  FROM bugs")).ExpectQuery().WillReturnRows(bugRows())
+	cnx.Mock.ExpectPrepare(regexp.QuoteMeta("SELECT  *  FROM bugs")).ExpectQuery().WillReturnRows(bugRows())
+	cnx.Mock.ExpectPrepare(regexp.QuoteMeta("SELECT COUNT(1) AS total FROM bugs LIMIT 1")).
+		ExpectQuery().
+		WillReturnRows(sqlmock.NewRows([]string{"total"}).AddRow(2))
+
+	bugs, err := m.ReturnType(&Bug{}).FindAll()
+	assert.Nil(err)
+	assert.Equal([]interface{}{Bug{1, "a"}, Bug{2, "b"}}, bugs)
+
+	var values []Bug
+	assert.Nil(m.Into(&values))
+	assert.Equal([]Bug{{1, "a"}, {2, "b"}}, values)
+
+	var pointers []*Bug
+	assert.Nil(m.Into(&pointers))
+	assert.Equal([]*Bug{{1, "a"}, {2, "b"}}, pointers)
+
+	var count Count
+	assert.Nil(m.Select("COUNT(1) AS total").Into(&count))
+	assert.Equal(Count{2}, count)
+	assert.Equal(&Bug{}, m.returnType)
+
+	assert.Equal("qw: Into expects a non nil pointer, got query.Count", m.Into(count).Error())
+	var names []string
+	assert.Equal("qw: return type must be a struct, got string", m.Into(&names).Error())
+
+	assert.Nil(cnx.Mock.ExpectationsWereMet())
+}
+
+func TestHookErrors(t *testing.T) {
+	s := []string{
+		"mock:mock@mock(127.0.0.1:3306)/mock",
+	}
+	cnx := new(CnxMock)
+	m, err := NewSQLQuery("bugs", s, cnx)
+
+	type Bug struct {
+		ID   int    `db:"id"`
+		Name string `db:"name"`
+	}
+
+	assert := assert.New(t)
+	assert.Nil(err)
+
+	errInvalid := errors.New("name is mandatory")
+	type ctxKey struct{}
+	var seen interface{}
+
+	m.BeforeInsert([]Hook{
+		func(ctx context.Context, event *HookEvent) error {
+			seen = ctx.Value(ctxKey{})
+			if event.Rows[0].(*Bug).Name == "" {
+				return errInvalid
+			}
+			return nil
+		},
+	})
+
+	//The invalid insert never reaches the db and rolls back the transaction
+	cnx.Mock.ExpectBegin()
+	cnx.Mock.ExpectRollback()
+
+	assert.Nil(m.Begin())
+	inserted, err := m.WithContext(context.WithValue(context.Background(), ctxKey{}, "request")).Insert(&Bug{ID: 1})
+	assert.Equal(errInvalid, err)
+	assert.False(inserted)
+	assert.Equal("request", seen)
+	assert.Equal(sql.ErrTxDone, m.Commit())
+
+	//After hook errors are returned once the statement ran
+	errAudit := errors.New("audit failed")
+	m.AfterUpdate([]Hook{
+		func(ctx context.Context, event *HookEvent) error {
+			return errAudit
+		},
+	})
+
+	cnx.Mock.ExpectPrepare(regexp.QuoteMeta("UPDATE bugs SET name = ? WHERE id = ?")).
+		ExpectExec().
+		WithArgs("crash", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	updated, err := m.Update(&Bug{1, "crash"})
+	assert.Equal(errAudit, err)
+	assert.False(updated)
+
+	assert.Nil(cnx.Mock.ExpectationsWereMet())
+}
+
+func TestHookEvents(t *testing.T) {
+	s := []string{
+		"mock:mock@mock(127.0.0.1:3306)/mock",
+	}
+	cnx := new(CnxMock)
+	m, err := NewSQLQuery("bugs", s, cnx)
+
+	type Bug struct {
+		ID   int    `db:"id"`
+		Name string `db:"name"`
+	}
+	m.returnType = new(Bug)
+
+	assert := assert.New(t)
+	assert.Nil(err)
+
+	events := []HookEvent{}
+	record := []Hook{
+		func(ctx context.Context, event *HookEvent) error {
+			events = append(events, *event)
+			return nil
+		},
+	}
+	m.BeforeInsert(record).AfterInsert(record).BeforeFind(record).AfterFind(record).AfterDelete(record)
+
+	cnx.Mock.ExpectPrepare(regexp.QuoteMeta("INSERT INTO bugs (name)  VALUES (?)")).
+		ExpectExec().
+		WithArgs("crash").
+		WillReturnResult(sqlmock.NewResult(7, 1))
+	cnx.Mock.ExpectPrepare(regexp.QuoteMeta("SELECT  *  FROM bugs WHERE name = ? LIMIT 10")).
+		ExpectQuery().
+		WithArgs("crash").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(7, "crash"))
+	cnx.Mock.ExpectPrepare(regexp.QuoteMeta("DELETE FROM bugs WHERE id = ?")).
+		ExpectExec().
+		WillReturnError(sql.ErrConnDone)
+
+	b := &Bug{Name: "crash"}
+	_, err = m.Insert(b)
+	assert.Nil(err)
+	_, err = m.WhereValue("name", "crash").Limit(10).FindAll()
+	assert.Nil(err)
+	_, err = m.Delete(b)
+	assert.Equal(sql.ErrConnDone, err)
+
+	assert.Len(events, 5)
+
+	assert.Equal(OpInsert, events[0].Operation)
+	assert.Equal("bugs", events[0].Table)
+	assert.Equal([]interface{}{b}, events[0].Rows)
+	assert.Empty(events[0].SQL)
+
+	assert.Equal("INSERT INTO bugs (name)  VALUES (?)", events[1].SQL)
+	assert.Equal([]interface{}{"crash"}, events[1].Args)
+	assert.Equal(int64(1), events[1].RowsAffected)
+	assert.Nil(events[1].Err)
+
+	//Before find hooks no longer see the inserted struct
+	assert.Equal(OpFind, events[2].Operation)
+	assert.Empty(events[2].Rows)
+	assert.Equal("SELECT  *  FROM bugs WHERE name = ? LIMIT 10", events[2].SQL)
+	assert.Equal([]interface{}{"crash"}, events[2].Args)
+
+	assert.Equal([]interface{}{Bug{7, "crash"}}, events[3].Rows)
+	assert.Equal(int64(1), events[3].RowsAffected)
+
+	//After hooks are told about failed statements
+	assert.Equal(OpDelete, events[4].Operation)
+	assert.Equal(sql.ErrConnDone, events[4].Err)
+	assert.Equal([]interface{}{7}, events[4].Args)
+
+	assert.Nil(cnx.Mock.ExpectationsWereMet())
+}
@@ -0,0 +1,312 @@
+package query
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+//field describes how a struct field maps on a column.
+//It is built from the `db` tag: the column name followed by options.
+//Without tag, the column is named by the NamingStrategy
+//	`db:"id,pk,auto"`         primary key filled by the database
+//	`db:"id,pk,gen=uuidv7"`   primary key generated before insert (uuid, uuidv7, ulid)
+//	`db:"created_on,readonly"` read but never written
+//	`db:"nickname,omitempty"`  not written when zero
+//	`db:"status,default"`      not inserted when zero, the column default applies
+//	`db:"version,version"`     optimistic locking version
+//	`db:"ip,conv=inet"`        converted by the Converter registered as inet
+//	`db:"payload,json"`        stored as a JSON document
+//	`db:"-"`                   ignored
+type field struct {
+	index      []int
+	column     string
+	pk         bool
+	auto       bool
+	readonly   bool
+	omitempty  bool
+	useDefault bool
+	version    bool
+
+	//name of the key generator filling the field before insert
+	generator string
+
+	//what is wrong with the field tag, if anything
+	err error
+
+	//converts the raw column value into the field
+	set func(target reflect.Value, value []byte) error
+
+	//whether database/sql can scan in the field itself, NULL included
+	direct bool
+
+	//whether a struct pointer leads to the field, allocated only once
+	//a non NULL value is read
+	lazy bool
+
+	//whether the field holds an integer
+	integer bool
+
+	//converts the field to and from the database, if registered
+	converter *Converter
+}
+
+//parseTag splits a `db` tag into the column name and its options.
+//`db:"version,version"` gives "version" and []string{"version"}
+func parseTag(tag string) (string, []string) {
+	parts := strings.Split(tag, ",")
+	return parts[0], parts[1:]
+}
+
+//hasOption returns whether option is part of the tag options
+func hasOption(options []string, option string) bool {
+	for index := 0; index < len(options); index++ {
+		if options[index] == option {
+			return true
+		}
+	}
+	return false
+}
+
+//optionValue returns the value of the option name=value, if any
+func optionValue(options []string, name string) string {
+	for index := 0; index < len(options); index++ {
+		if strings.HasPrefix(options[index], name+"=") {
+			return strings.TrimPrefix(options[index], name+"=")
+		}
+	}
+	return ""
+}
+
+//fieldsOf returns the mapped fields of the struct type t.
+//Fields without `db` tag are named by naming, unexported and `db:"-"`
+//ones are left out.
+//Embedded structs are flattened and named struct fields tagged with
+//the prefix option are mapped with their columns prefixed
+//	Address Address `db:"addr_,prefix"` // addr_street, addr_city...
+func fieldsOf(t reflect.Type, naming NamingStrategy) []field {
+	return appendFields([]field{}, t, naming, []int{}, "", []reflect.Type{t})
+}
+
+//appendFields appends to fields the ones of the struct type t found
+//at index and whose columns start with prefix.
+//path holds the struct types leading to t, a struct can't be mapped
+//within itself
+func appendFields(fields []field, t reflect.Type, naming NamingStrategy, index []int, prefix string, path []reflect.Type) []field {
+
+	for i := 0; i < t.NumField(); i++ {
+
+		structField := t.Field(i)
+		tag, dbTagPresent := structField.Tag.Lookup("db")
+		if tag == "-" {
+			continue
+		}
+
+		fieldIndex := append(append([]int{}, index...), i)
+		column, options := parseTag(tag)
+
+		nested := structField.Type
+		if nested.Kind() == reflect.Ptr {
+			nested = nested.Elem()
+		}
+		if nested.Kind() == reflect.Struct && (hasOption(options, "prefix") ||
+			(structField.Anonymous && !dbTagPresent && nested != timeType && !isDirect(structField.Type))) {
+			//Embedded pointers to unexported structs can't be allocated
+			if structField.PkgPath != "" && structField.Type.Kind() == reflect.Ptr {
+				continue
+			}
+			if containsType(path, nested) {
+				fields = append(fields, field{
+					index:  fieldIndex,
+					column: prefix + column,
+					err:    tagError(structField, fmt.Errorf("qw: %v can't be mapped within itself", nested)),
+					set:    setterOf(structField.Type),
+				})
+				continue
+			}
+			nestedPath := append(append([]reflect.Type{}, path...), nested)
+			fields = appendFields(fields, nested, naming, fieldIndex, prefix+column, nestedPath)
+			continue
+		}
+
+		if structField.PkgPath != "" {
+			continue
+		}
+		if !dbTagPresent || column == "" {
+			column = naming.ColumnName(structField.Name)
+		}
+
+		integer := isInteger(structField.Type.Kind())
+
+		var err error
+		if hasOption(options, "version") && !integer {
+			err = fmt.Errorf("qw: a version needs an integer field, not a %v", structField.Type)
+		}
+		generator := optionValue(options, "gen")
+		if generator != "" && err == nil {
+			err = checkGenerator(structField.Type, generator)
+		}
+
+		conv := optionValue(options, "conv")
+		converter := converterOf(structField.Type, conv)
+		if conv != "" && converter == nil && err == nil {
+			err = fmt.Errorf("qw: no converter registered as %q", conv)
+		}
+		if hasOption(options, "json") {
+			converter = jsonConverter(structField.Type)
+		}
+
+		fields = append(fields, field{
+			index:      fieldIndex,
+			column:     prefix + column,
+			pk:         hasOption(options, "pk"),
+			auto:       hasOption(options, "auto"),
+			readonly:   hasOption(options, "readonly"),
+			omitempty:  hasOption(options, "omitempty"),
+			useDefault: hasOption(options, "default"),
+			version:    hasOption(options, "version"),
+			generator:  generator,
+			err:        tagError(structField, err),
+			set:        setterOf(structField.Type),
+			direct:     isDirect(structField.Type),
+			integer:    integer,
+			converter:  converter,
+		})
+	}
+
+	return fields
+}
+
+//tagError places err on the field it comes from
+func tagError(structField reflect.StructField, err error) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("%v on field %s", err, structField.Name)
+}
+
+//containsType returns whether t is one of types
+func containsType(types []reflect.Type, t reflect.Type) bool {
+	for index := 0; index < len(types); index++ {
+		if types[index] == t {
+			return true
+		}
+	}
+	return false
+}
+
+//throughPointer returns whether a struct pointer leads from the struct
+//type t to its field at index
+func throughPointer(t reflect.Type, index []int) bool {
+	for i := 0; i < len(index)-1; i++ {
+		t = t.Field(index[i]).Type
+		if t.Kind() == reflect.Ptr {
+			return true
+		}
+	}
+	return false
+}
+
+//fieldOf returns the field at index in v, allocating the nil struct
+//pointers on the way
+func fieldOf(v reflect.Value, index []int) reflect.Value {
+	for i := 0; i < len(index); i++ {
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(index[i])
+	}
+	return v
+}
+
+//valueOf returns the value of the field at index in v, nil when a
+//struct pointer on the way is nil
+func valueOf(v reflect.Value, index []int) interface{} {
+	for i := 0; i < len(index); i++ {
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return nil
+			}
+			v = v.Elem()
+		}
+		v = v.Field(index[i])
+	}
+
+	//Drivers take []byte, not byte arrays such as raw UUIDs
+	if v.Kind() == reflect.Array && v.Type().Elem().Kind() == reflect.Uint8 &&
+		!v.Type().Implements(valuerType) {
+		bytes := make([]byte, v.Len())
+		reflect.Copy(reflect.ValueOf(bytes), v)
+		return bytes
+	}
+	return v.Interface()
+}
+
+//isZero returns whether value is nil or the zero value of its type
+func isZero(value interface{}) bool {
+	return value == nil || reflect.ValueOf(value).IsZero()
+}
+
+//primaryKey returns the positions in fields of the primary key
+//columns and whether the database fills the key.
+//Without any field tagged pk, the fields mapped on the model keys
+//are used; a single integer one is considered auto-incremented as it
+//always was
+func (model *SQLQuery) primaryKey(fields []field) ([]int, bool) {
+	keys := []int{}
+	for index := 0; index < len(fields); index++ {
+		if fields[index].pk {
+			keys = append(keys, index)
+		}
+	}
+	if len(keys) > 0 {
+		return keys, len(keys) == 1 && fields[keys[0]].auto
+	}
+
+	for k := 0; k < len(model.keys); k++ {
+		for index := 0; index < len(fields); index++ {
+			if fields[index].column == model.keys[k] {
+				keys = append(keys, index)
+				break
+			}
+		}
+	}
+	if len(keys) != len(model.keys) {
+		return nil, false
+	}
+
+	return keys, len(keys) == 1 && fields[keys[0]].integer
+}
+
+//keyWhere returns the WHERE condition on the key columns and the key
+//values of the struct s
+func keyWhere(s reflect.Value, fields []field, keys []int) (string, []interface{}, error) {
+	conditions := []string{}
+	values := []interface{}{}
+	for index := 0; index < len(keys); index++ {
+		value, err := toDB(valueOf(s, fields[keys[index]].index), fields[keys[index]].converter)
+		if err != nil {
+			return "", nil, err
+		}
+		conditions = append(conditions, fields[keys[index]].column+" = ?")
+		values = append(values, value)
+	}
+	return strings.Join(conditions, " AND "), values, nil
+}
+
+//versionIndex returns the position in fields of the version column,
+//which must hold an integer
+func (model *SQLQuery) versionIndex(fields []field) (int, error) {
+	for index := 0; index < len(fields); index++ {
+		if fields[index].version || (model.versionField != "" && fields[index].column == model.versionField) {
+			if !fields[index].integer {
+				return -1, fmt.Errorf("qw: version column %s isn't an integer", fields[index].column)
+			}
+			return index, nil
+		}
+	}
+	return -1, nil
+}
@@ -0,0 +1,149 @@
+package query
+
+import (
+	"context"
+	"sync"
+
+	"github.com/mathieunls/qw/connector"
+)
+
+//Tracer starts a span around every statement and transaction of the
+//models it is given to. The qwotel package adapts OpenTelemetry
+type Tracer interface {
+
+	//Start opens a span under the one of ctx and returns the context
+	//carrying it
+	Start(ctx context.Context, name string, attributes map[string]interface{}) (context.Context, Span)
+}
+
+//Span is an operation being traced
+type Span interface {
+	SetAttributes(attributes map[string]interface{})
+
+	//End closes the span, failed if err isn't nil
+	End(err error)
+}
+
+//dbSystems maps the dialects on the OpenTelemetry db.system values
+var dbSystems = map[string]string{
+	MySQL:    "mysql",
+	Postgres: "postgresql",
+	SQLite:   "sqlite",
+}
+
+//Tracer sets the tracer of the model statements and transactions
+func (model *SQLQuery) Tracer(tracer Tracer) *SQLQuery {
+	model.tracer = tracer
+	return model
+}
+
+//startSpan opens the span of statement, if the model is traced
+func (model *SQLQuery) startSpan(ctx context.Context, statement *connector.Statement) (context.Context, Span) {
+	if model.tracer == nil {
+		return ctx, nil
+	}
+
+	return model.tracer.Start(ctx, statement.Operation+" "+statement.Table, map[string]interface{}{
+		"db.system":    model.dbSystem(),
+		"db.statement": statement.SQL,
+		"db.operation": statement.Operation,
+		"db.sql.table": statement.Table,
+	})
+}
+
+//endSpan closes the span of statement with the rows it returned, or
+//affected for the writes
+func endSpan(span Span, statement *connector.Statement, rows int64, err error) {
+	if span == nil {
+		return
+	}
+
+	rowsKey := "db.rows_affected"
+	if statement.Operation == string(OpFind) {
+		rowsKey = "db.response.returned_rows"
+	}
+	span.SetAttributes(map[string]interface{}{
+		"db.statement": statement.SQL,
+		rowsKey:        rows,
+	})
+	span.End(err)
+}
+
+//dbSystem returns the db.system of the model dialect
+func (model *SQLQuery) dbSystem() string {
+	if system, ok := dbSystems[model.dialect]; ok {
+		return system
+	}
+	return model.dialect
+}
+
+//statementContext returns the context statements run with: the one of
+//the ongoing transaction, if any, so their spans nest in it
+func (model *SQLQuery) statementContext() context.Context {
+	if model.txCtx != nil {
+		return model.txCtx
+	}
+	return model.context()
+}
+
+//SpanRecorder is an in-memory Tracer, handy in tests
+type SpanRecorder struct {
+	mutex sync.Mutex
+	spans []*RecordedSpan
+}
+
+//RecordedSpan is a span kept by a SpanRecorder
+type RecordedSpan struct {
+	Name       string
+	Attributes map[string]interface{}
+
+	//Name of the span it was started under, empty for the roots
+	Parent string
+
+	Ended bool
+	Err   error
+
+	recorder *SpanRecorder
+}
+
+//recordedSpanKey is the context key of the current RecordedSpan
+type recordedSpanKey struct{}
+
+//Start records a new span under the one of ctx
+func (recorder *SpanRecorder) Start(ctx context.Context, name string, attributes map[string]interface{}) (context.Context, Span) {
+	span := &RecordedSpan{Name: name, Attributes: map[string]interface{}{}, recorder: recorder}
+	if parent, ok := ctx.Value(recordedSpanKey{}).(*RecordedSpan); ok {
+		span.Parent = parent.Name
+	}
+	span.SetAttributes(attributes)
+
+	recorder.mutex.Lock()
+	recorder.spans = append(recorder.spans, span)
+	recorder.mutex.Unlock()
+
+	return context.WithValue(ctx, recordedSpanKey{}, span), span
+}
+
+//Spans returns the spans recorded so far, in start order
+func (recorder *SpanRecorder) Spans() []*RecordedSpan {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	return append([]*RecordedSpan{}, recorder.spans...)
+}
+
+//SetAttributes adds attributes to the span
+func (span *RecordedSpan) SetAttributes(attributes map[string]interface{}) {
+	span.recorder.mutex.Lock()
+	defer span.recorder.mutex.Unlock()
+	for key, value := range attributes {
+		span.Attributes[key] = value
+	}
+}
+
+//End marks the span ended
+func (span *RecordedSpan) End(err error) {
+	span.recorder.mutex.Lock()
+	defer span.recorder.mutex.Unlock()
+	span.Ended = true
+	span.Err = err
+}
@@ -0,0 +1,80 @@
+package query
+
+import (
+	"regexp"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTracer(t *testing.T) {
+	s := []string{
+		"mock:mock@mock(127.0.0.1:3306)/mock",
+	}
+	cnx := new(CnxMock)
+	m, err := NewSQLQuery("bugs", s, cnx)
+
+	type Bug struct {
+		ID   int    `db:"id"`
+		Name string `db:"name"`
+	}
+	m.returnType = new(Bug)
+
+	assert := assert.New(t)
+	assert.Nil(err)
+
+	recorder := new(SpanRecorder)
+	m.Tracer(recorder)
+
+	cnx.Mock.ExpectBegin()
+	cnx.Mock.ExpectPrepare(regexp.QuoteMeta("SELECT  *  FROM bugs WHERE name = ?")).
+		ExpectQuery().
+		WithArgs("crash").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "crash").AddRow(2, "crash"))
+	cnx.Mock.ExpectPrepare(regexp.QuoteMeta("INSERT INTO bugs (name)  VALUES (?)")).
+		ExpectExec().
+		WithArgs("hang").
+		WillReturnResult(sqlmock.NewResult(3, 1))
+	cnx.Mock.ExpectCommit()
+	cnx.Mock.ExpectQuery(regexp.QuoteMeta("SELECT  count(1)  FROM bugs")).
+		WillReturnError(sqlmock.ErrCancelled)
+
+	assert.Nil(m.Begin())
+	_, err = m.WhereValue("name", "crash").FindAll()
+	assert.Nil(err)
+	_, err = m.Insert(&Bug{Name: "hang"})
+	assert.Nil(err)
+	assert.Nil(m.Commit())
+	_, err = m.CountAll()
+	assert.Equal(sqlmock.ErrCancelled, err)
+
+	spans := recorder.Spans()
+	assert.Len(spans, 4)
+
+	assert.Equal("transaction", spans[0].Name)
+	assert.Equal("commit", spans[0].Attributes["db.transaction.outcome"])
+	assert.True(spans[0].Ended)
+
+	assert.Equal("SELECT bugs", spans[1].Name)
+	assert.Equal("transaction", spans[1].Parent)
+	assert.Equal(map[string]interface{}{
+		"db.system":                 "mysql",
+		"db.statement":              "SELECT  *  FROM bugs WHERE name = ?",
+		"db.operation":              "SELECT",
+		"db.sql.table":              "bugs",
+		"db.response.returned_rows": int64(2),
+	}, spans[1].Attributes)
+
+	assert.Equal("INSERT bugs", spans[2].Name)
+	assert.Equal("transaction", spans[2].Parent)
+	assert.Equal(int64(1), spans[2].Attributes["db.rows_affected"])
+	assert.True(spans[2].Ended)
+	assert.Nil(spans[2].Err)
+
+	//Once committed, statements are roots again
+	assert.Equal("", spans[3].Parent)
+	assert.Equal(sqlmock.ErrCancelled, spans[3].Err)
+
+	assert.Nil(cnx.Mock.ExpectationsWereMet())
+}
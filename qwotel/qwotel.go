@@ -0,0 +1,81 @@
+//Package qwotel adapts OpenTelemetry tracing to qw models
+//
+//model.Tracer(qwotel.NewTracer(otel.Tracer("qw")))
+package qwotel
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/mathieunls/qw/query"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+//NewTracer returns a query.Tracer opening client spans with tracer
+func NewTracer(tracer trace.Tracer) query.Tracer {
+	return otelTracer{tracer}
+}
+
+//otelTracer is a query.Tracer backed by OpenTelemetry
+type otelTracer struct {
+	tracer trace.Tracer
+}
+
+//Start opens a client span under the one of ctx
+func (t otelTracer) Start(ctx context.Context, name string, attributes map[string]interface{}) (context.Context, query.Span) {
+	ctx, span := t.tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(toAttributes(attributes)...))
+	return ctx, otelSpan{span}
+}
+
+//otelSpan is a query.Span backed by OpenTelemetry
+type otelSpan struct {
+	span trace.Span
+}
+
+//SetAttributes adds attributes to the span
+func (s otelSpan) SetAttributes(attributes map[string]interface{}) {
+	s.span.SetAttributes(toAttributes(attributes)...)
+}
+
+//End records err, if any, and ends the span
+func (s otelSpan) End(err error) {
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+	s.span.End()
+}
+
+//toAttributes converts attributes in key order
+func toAttributes(attributes map[string]interface{}) []attribute.KeyValue {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	kvs := make([]attribute.KeyValue, 0, len(keys))
+	for index := 0; index < len(keys); index++ {
+		key := keys[index]
+		switch value := attributes[key].(type) {
+		case string:
+			kvs = append(kvs, attribute.String(key, value))
+		case int:
+			kvs = append(kvs, attribute.Int(key, value))
+		case int64:
+			kvs = append(kvs, attribute.Int64(key, value))
+		case float64:
+			kvs = append(kvs, attribute.Float64(key, value))
+		case bool:
+			kvs = append(kvs, attribute.Bool(key, value))
+		default:
+			kvs = append(kvs, attribute.String(key, fmt.Sprint(value)))
+		}
+	}
+	return kvs
+}
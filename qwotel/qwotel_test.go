@@ -0,0 +1,48 @@
+package qwotel
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracer(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	tracer := NewTracer(provider.Tracer("qw"))
+
+	assert := assert.New(t)
+
+	ctx, tx := tracer.Start(context.Background(), "transaction", map[string]interface{}{"db.system": "mysql"})
+	_, span := tracer.Start(ctx, "SELECT bugs", map[string]interface{}{
+		"db.statement": "SELECT * FROM bugs",
+		"db.operation": "SELECT",
+	})
+	span.SetAttributes(map[string]interface{}{"db.response.returned_rows": int64(2)})
+	span.End(errors.New("timeout"))
+	tx.End(nil)
+
+	spans := exporter.GetSpans()
+	assert.Len(spans, 2)
+
+	selectSpan := spans[0]
+	assert.Equal("SELECT bugs", selectSpan.Name)
+	assert.Equal(trace.SpanKindClient, selectSpan.SpanKind)
+	assert.Equal(spans[1].SpanContext.SpanID(), selectSpan.Parent.SpanID())
+	assert.Equal([]attribute.KeyValue{
+		attribute.String("db.operation", "SELECT"),
+		attribute.String("db.statement", "SELECT * FROM bugs"),
+		attribute.Int64("db.response.returned_rows", 2),
+	}, selectSpan.Attributes)
+	assert.Equal(codes.Error, selectSpan.Status.Code)
+	assert.Equal("timeout", selectSpan.Status.Description)
+
+	assert.Equal(codes.Unset, spans[1].Status.Code)
+}